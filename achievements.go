@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	achievementsFile      = "assets/data/achievements.json"
+	achievementsVersion   = 1
+	achievementToast      = 180     // ticks each unlock is shown for
+	achievementFlushTicks = 30 * 60 // save changed counts this often
+)
+
+// Triggers are the gameplay events achievements count
+const (
+	TriggerFish          = "fish"          // a fish was eaten, Species is set
+	TriggerNearMiss      = "nearMiss"      // a car passed close by without hitting the cat
+	TriggerLevelComplete = "levelComplete" // went through the portal
+	TriggerFlawless      = "flawless"      // finished a level without losing a life
+	TriggerAllSpecies    = "allSpecies"    // ate every fish species on one level
+)
+
+var triggers = map[string]bool{
+	TriggerFish: true, TriggerNearMiss: true, TriggerLevelComplete: true, TriggerFlawless: true, TriggerAllSpecies: true,
+}
+
+// Trigger is one thing that happened in the game
+type Trigger struct {
+	Kind    string
+	Species string
+	Level   int
+}
+
+// AchievementDef is an achievement as written in the data file. It counts
+// its trigger, optionally only for one species or level, and unlocks when
+// the count across all games reaches Count.
+type AchievementDef struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	On          string `json:"on"`
+	Species     string `json:"species,omitempty"`
+	Level       int    `json:"level,omitempty"`
+	Count       int    `json:"count,omitempty"` // defaults to 1
+}
+
+func (d *AchievementDef) matches(t Trigger) bool {
+	return d.On == t.Kind && (d.Species == "" || d.Species == t.Species) && (d.Level == 0 || d.Level == t.Level)
+}
+
+// LoadAchievementDefs reads the achievement list and checks it
+func LoadAchievementDefs(fsys fs.FS, file string) ([]*AchievementDef, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+	var defs []*AchievementDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, d := range defs {
+		if d.ID == "" || seen[d.ID] {
+			return nil, fmt.Errorf("%s: missing or duplicate id %q", file, d.ID)
+		}
+		seen[d.ID] = true
+		if !triggers[d.On] {
+			return nil, fmt.Errorf("%s: achievement %q has unknown trigger %q", file, d.ID, d.On)
+		}
+		if d.Count < 0 {
+			return nil, fmt.Errorf("%s: achievement %q has a negative count", file, d.ID)
+		}
+		if d.Count == 0 {
+			d.Count = 1
+		}
+	}
+	return defs, nil
+}
+
+// achievementProgress is what's saved in achievements.json next to the save
+// file
+type achievementProgress struct {
+	Version  int               `json:"version"`
+	Counts   map[string]int    `json:"counts"`   // by achievement id
+	Unlocked map[string]string `json:"unlocked"` // date, by achievement id
+}
+
+// Achievements reacts to triggers from gameplay, keeps the progress on disk
+// and shows a toast for each unlock
+type Achievements struct {
+	defs     []*AchievementDef
+	progress achievementProgress
+	readOnly bool // the progress file couldn't be read, leave it alone
+	dirty    bool // counts changed since the last save
+
+	toasts     []*AchievementDef // waiting to be shown, first is showing
+	toastTimer int
+	scroll     int // first row on the achievements screen
+}
+
+func NewAchievements(fsys fs.FS, file string) *Achievements {
+	a := &Achievements{}
+	defs, err := LoadAchievementDefs(fsys, file)
+	if err != nil {
+		log.Printf("Warning: Failed to load achievements: %v", err)
+	}
+	a.defs = defs
+	a.load()
+	return a
+}
+
+func achievementsPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "achievements.json"), nil
+}
+
+// load reads the saved progress. A file that can't be parsed is moved aside
+// to achievements.json.bad and progress starts over.
+func (a *Achievements) load() {
+	a.progress = achievementProgress{Version: achievementsVersion, Counts: make(map[string]int), Unlocked: make(map[string]string)}
+	path, err := achievementsPath()
+	if err != nil {
+		a.readOnly = true
+		return
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to read achievements: %v", err)
+		a.readOnly = true
+		return
+	}
+
+	var saved achievementProgress
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		log.Printf("Warning: Achievements %s are damaged (%v), starting over", path, err)
+		if err := os.Rename(path, path+".bad"); err != nil {
+			log.Printf("Warning: Failed to move damaged achievements aside: %v", err)
+			a.readOnly = true
+		}
+		return
+	}
+	if saved.Version > achievementsVersion {
+		log.Printf("Warning: Achievements %s are from a newer version of the game, progress won't be saved", path)
+		a.readOnly = true
+		return
+	}
+	// Progress for achievements that no longer exist is kept, in case they
+	// come back
+	for id, n := range saved.Counts {
+		if n > 0 {
+			a.progress.Counts[id] = n
+		}
+	}
+	for id, date := range saved.Unlocked {
+		a.progress.Unlocked[id] = date
+	}
+}
+
+// Flush saves counts that changed since the last save. Counting alone
+// doesn't save, so this is called when a level or run ends, every
+// achievementFlushTicks in case the game crashes, and when it closes.
+func (a *Achievements) Flush() {
+	if a.dirty {
+		a.save()
+	}
+}
+
+func (a *Achievements) save() {
+	if a.readOnly {
+		return
+	}
+	a.dirty = false
+	path, err := achievementsPath()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	var out []byte
+	if err == nil {
+		out, err = json.MarshalIndent(a.progress, "", "  ")
+	}
+	if err == nil {
+		err = os.WriteFile(path+".tmp", out, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to save achievements: %v", err)
+	}
+}
+
+// Trigger counts a gameplay event towards every achievement it matches. It
+// only saves when something unlocks; see Flush.
+func (a *Achievements) Trigger(t Trigger) {
+	unlocked := false
+	for _, d := range a.defs {
+		if a.progress.Unlocked[d.ID] != "" || !d.matches(t) {
+			continue
+		}
+		a.progress.Counts[d.ID]++
+		a.dirty = true
+		if a.progress.Counts[d.ID] >= d.Count {
+			unlocked = true
+			a.progress.Unlocked[d.ID] = time.Now().Format("2006-01-02")
+			a.toasts = append(a.toasts, d)
+			if len(a.toasts) == 1 {
+				a.toastTimer = achievementToast
+			}
+		}
+	}
+	if unlocked {
+		a.save()
+	}
+}
+
+// Unlocked is how many achievements have been earned
+func (a *Achievements) Unlocked() int {
+	n := 0
+	for _, d := range a.defs {
+		if a.progress.Unlocked[d.ID] != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Update moves the toasts along, once per tick
+func (a *Achievements) Update() {
+	if len(a.toasts) == 0 {
+		return
+	}
+	a.toastTimer--
+	if a.toastTimer <= 0 {
+		a.toasts = a.toasts[1:]
+		a.toastTimer = achievementToast
+	}
+}
+
+// DrawToast shows the latest unlock in the bottom-right corner
+func (a *Achievements) DrawToast(screen *ebiten.Image) {
+	if len(a.toasts) == 0 {
+		return
+	}
+	d := a.toasts[0]
+	w := max(len(d.Name), 22)*7 + 20
+	x := screenWidth - w - 10
+	y := screenHeight - 60
+
+	panel := ebiten.NewImage(w, 44)
+	panel.Fill(color.RGBA{20, 20, 40, 220})
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(x), float64(y))
+	screen.DrawImage(panel, op)
+	text.Draw(screen, "Achievement unlocked!", basicfont.Face7x13, x+10, y+18, color.RGBA{255, 215, 0, 255})
+	text.Draw(screen, d.Name, basicfont.Face7x13, x+10, y+36, color.White)
+}
+
+// achieve passes a trigger on to the achievements, unless the run was
+// cheated or quick loaded
+func (g *Game) achieve(t Trigger) {
+	if !g.cheated {
+		g.achievements.Trigger(t)
+	}
+}
+
+// showAchievements opens the achievements screen
+func (g *Game) showAchievements() {
+	g.returnState = g.state
+	g.state = StateAchievements
+	g.achievements.scroll = 0
+}
+
+func (g *Game) updateAchievements() {
+	a := g.achievements
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyA) {
+		g.state = g.returnState
+		g.audioManager.Play("click")
+	}
+	if repeatingKeyPressed(ebiten.KeyDown) && a.scroll+achievementRows < len(a.defs) {
+		a.scroll++
+	}
+	if repeatingKeyPressed(ebiten.KeyUp) && a.scroll > 0 {
+		a.scroll--
+	}
+}
+
+const achievementRows = 10
+
+func (g *Game) drawAchievements(screen *ebiten.Image) {
+	a := g.achievements
+	title := fmt.Sprintf("ACHIEVEMENTS  %d/%d", a.Unlocked(), len(a.defs))
+	text.Draw(screen, title, basicfont.Face7x13, screenWidth/2-len(title)*7/2, 70, color.RGBA{255, 215, 0, 255})
+
+	y := 110
+	for i := a.scroll; i < len(a.defs) && i < a.scroll+achievementRows; i++ {
+		d := a.defs[i]
+		nameColor := color.Color(color.RGBA{140, 140, 140, 255})
+		status := fmt.Sprintf("%d/%d", min(a.progress.Counts[d.ID], d.Count), d.Count)
+		if date := a.progress.Unlocked[d.ID]; date != "" {
+			nameColor = color.RGBA{255, 215, 0, 255}
+			status = date
+		}
+		text.Draw(screen, d.Name, basicfont.Face7x13, 80, y, nameColor)
+		text.Draw(screen, status, basicfont.Face7x13, screenWidth-80-len(status)*7, y, nameColor)
+		text.Draw(screen, d.Description, basicfont.Face7x13, 100, y+16, color.RGBA{200, 200, 200, 255})
+		y += 40
+	}
+
+	help := "Up/Down: Scroll  Esc: Back"
+	text.Draw(screen, help, basicfont.Face7x13, screenWidth/2-len(help)*7/2, screenHeight-40, color.RGBA{200, 200, 200, 255})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"image"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// AnimClip is a sequence of frames, optionally with one sequence per facing
+// direction. Timing is in ticks so clips play the same regardless of FPS.
+// Clips normally come from an Atlas.
+type AnimClip struct {
+	frames    [][]*ebiten.Image // [direction][frame]; a single row is used for every direction
+	offsets   [][]image.Point   // per-frame draw offset from trimming and pivots, may be nil
+	durations []int             // ticks per frame
+	loop      bool
+	events    map[int]string // event fired when the clip reaches a frame
+	tint      []float32      // optional RGB color scale
+}
+
+// NewAnimClip makes a clip where every frame lasts frameTicks
+func NewAnimClip(frames [][]*ebiten.Image, frameTicks int, loop bool) *AnimClip {
+	if frameTicks < 1 {
+		frameTicks = 1
+	}
+	durations := make([]int, len(frames[0]))
+	for i := range durations {
+		durations[i] = frameTicks
+	}
+	return &AnimClip{
+		frames:    frames,
+		durations: durations,
+		loop:      loop,
+		events:    make(map[int]string),
+	}
+}
+
+// TotalTicks is how long one pass through the clip takes
+func (c *AnimClip) TotalTicks() int {
+	total := 0
+	for _, d := range c.durations {
+		total += d
+	}
+	return total
+}
+
+// OnFrame fires event every time the clip reaches frame
+func (c *AnimClip) OnFrame(frame int, event string) *AnimClip {
+	c.events[frame] = event
+	return c
+}
+
+func (c *AnimClip) WithTint(r, g, b float32) *AnimClip {
+	c.tint = []float32{r, g, b}
+	return c
+}
+
+func (c *AnimClip) directionFrames(dir int) []*ebiten.Image {
+	if dir >= 0 && dir < len(c.frames) {
+		return c.frames[dir]
+	}
+	return c.frames[0]
+}
+
+func (c *AnimClip) frameCount() int {
+	return len(c.frames[0])
+}
+
+func (c *AnimClip) offset(dir, frame int) image.Point {
+	if len(c.offsets) == 0 {
+		return image.Point{}
+	}
+	if dir < 0 || dir >= len(c.offsets) {
+		dir = 0
+	}
+	return c.offsets[dir][frame]
+}
+
+type animTransition struct {
+	from string // "*" matches any state
+	to   string
+	when func() bool
+}
+
+// AnimStateMachine plays one named clip at a time. Transitions are checked
+// in the order they were added at the start of every Update; Play switches
+// state directly for one-off triggers like getting hurt.
+type AnimStateMachine struct {
+	states      map[string]*AnimClip
+	transitions []animTransition
+	current     string
+	frame       int
+	tick        int
+	finished    bool // a one-shot clip reached its last frame
+
+	OnEvent func(event string)
+}
+
+func NewAnimStateMachine() *AnimStateMachine {
+	return &AnimStateMachine{states: make(map[string]*AnimClip)}
+}
+
+// AddState registers a clip. The first state added is the initial state.
+func (m *AnimStateMachine) AddState(name string, clip *AnimClip) {
+	m.states[name] = clip
+	if m.current == "" {
+		m.current = name
+	}
+}
+
+func (m *AnimStateMachine) AddTransition(from, to string, when func() bool) {
+	m.transitions = append(m.transitions, animTransition{from: from, to: to, when: when})
+}
+
+// Play switches to a state and restarts its clip
+func (m *AnimStateMachine) Play(name string) {
+	if m.states[name] == nil {
+		return
+	}
+	m.current = name
+	m.frame = 0
+	m.tick = 0
+	m.finished = false
+	m.fire()
+}
+
+// FrameSize is the size of the current frame
+func (m *AnimStateMachine) FrameSize() (int, int) {
+	clip := m.states[m.current]
+	if clip == nil {
+		return 0, 0
+	}
+	b := clip.frames[0][m.frame].Bounds()
+	return b.Dx(), b.Dy()
+}
+
+func (m *AnimStateMachine) Current() string {
+	return m.current
+}
+
+// Frame is the frame of the current clip being shown
+func (m *AnimStateMachine) Frame() int {
+	return m.frame
+}
+
+// Finished reports whether a one-shot clip has played through
+func (m *AnimStateMachine) Finished() bool {
+	return m.finished
+}
+
+func (m *AnimStateMachine) Update() {
+	for _, t := range m.transitions {
+		if (t.from == "*" || t.from == m.current) && t.to != m.current && t.when() {
+			m.Play(t.to)
+			break
+		}
+	}
+
+	clip := m.states[m.current]
+	if clip == nil || m.finished {
+		return
+	}
+
+	m.tick++
+	if m.tick < clip.durations[m.frame] {
+		return
+	}
+	m.tick = 0
+
+	if m.frame+1 < clip.frameCount() {
+		m.frame++
+	} else if clip.loop {
+		m.frame = 0
+	} else {
+		m.finished = true
+		return
+	}
+	m.fire()
+}
+
+func (m *AnimStateMachine) fire() {
+	clip := m.states[m.current]
+	if clip == nil || m.OnEvent == nil {
+		return
+	}
+	if event, ok := clip.events[m.frame]; ok {
+		m.OnEvent(event)
+	}
+}
+
+// Draw draws the current frame for the given facing direction
+func (m *AnimStateMachine) Draw(target *ebiten.Image, op *ebiten.DrawImageOptions, dir int) {
+	m.DrawState(target, op, m.current, m.frame, dir)
+}
+
+// DrawState draws any frame of any state, e.g. to replay a recording
+func (m *AnimStateMachine) DrawState(target *ebiten.Image, op *ebiten.DrawImageOptions, state string, frame, dir int) {
+	clip := m.states[state]
+	if clip == nil {
+		return
+	}
+
+	frames := clip.directionFrames(dir)
+	if frame < 0 || frame >= len(frames) {
+		return
+	}
+	if len(clip.tint) == 3 {
+		op.ColorScale.Scale(clip.tint[0], clip.tint[1], clip.tint[2], 1)
+	}
+	if off := clip.offset(dir, frame); off != (image.Point{}) {
+		var geoM ebiten.GeoM
+		geoM.Translate(float64(off.X), float64(off.Y))
+		geoM.Concat(op.GeoM)
+		op.GeoM = geoM
+	}
+	target.DrawImage(frames[frame], op)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/lafriks/go-tiled"
+)
+
+const hotReloadInterval = 60 // ticks between checking files for changes
+
+// AssetManager loads assets by path on first use and caches them. Paths are
+// slash separated and relative to the repo root, e.g. "assets/items/Bass.png".
+//
+// Assets normally come from the embedded FS. In dev mode they're read from a
+// directory on disk instead and changed PNG and TMX files are reloaded while
+// the game runs.
+type AssetManager struct {
+	fsys    fs.FS
+	devDir  string // "" unless in dev mode
+	images  map[string]*ebiten.Image
+	atlases map[string]*Atlas
+	missing map[string]error
+
+	// Dev mode only
+	modTimes    map[string]time.Time
+	reloadTimer int
+	OnReload    func(path string) // called after a watched file changes
+}
+
+func NewAssetManager(embedded fs.FS, devDir string) *AssetManager {
+	am := &AssetManager{
+		fsys:     embedded,
+		devDir:   devDir,
+		images:   make(map[string]*ebiten.Image),
+		atlases:  make(map[string]*Atlas),
+		missing:  make(map[string]error),
+		modTimes: make(map[string]time.Time),
+	}
+	if devDir != "" {
+		am.fsys = os.DirFS(devDir)
+		log.Printf("Loading assets from %s with hot reload", devDir)
+	}
+	return am
+}
+
+// FS is the filesystem assets are read from
+func (am *AssetManager) FS() fs.FS {
+	return am.fsys
+}
+
+// ReadFile reads a raw asset file, recording it as missing on failure
+func (am *AssetManager) ReadFile(name string) ([]byte, error) {
+	data, err := fs.ReadFile(am.fsys, name)
+	if err != nil {
+		am.missing[name] = err
+		return nil, err
+	}
+	am.watch(name)
+	return data, nil
+}
+
+// Image returns the image at path, loading it the first time. Missing or
+// broken images are replaced with a magenta placeholder and recorded.
+func (am *AssetManager) Image(name string) *ebiten.Image {
+	if img, ok := am.images[name]; ok {
+		return img
+	}
+
+	img, err := am.decodeImage(name)
+	if err != nil {
+		log.Printf("Warning: Failed to load %s: %v", name, err)
+		am.missing[name] = err
+		img = ebiten.NewImage(64, 64)
+		img.Fill(color.RGBA{255, 0, 255, 255}) // Magenta placeholder
+	} else {
+		am.watch(name)
+	}
+
+	am.images[name] = img
+	return img
+}
+
+func (am *AssetManager) decodeImage(name string) (*ebiten.Image, error) {
+	data, err := fs.ReadFile(am.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := ebitenutil.NewImageFromReader(bytes.NewReader(data))
+	return img, err
+}
+
+// Atlas returns the sprite atlas described by the JSON file at path
+func (am *AssetManager) Atlas(name string) (*Atlas, error) {
+	if a, ok := am.atlases[name]; ok {
+		return a, nil
+	}
+
+	a, err := LoadAtlas(am.fsys, name, am.Image)
+	if err != nil {
+		am.missing[name] = err
+		return nil, err
+	}
+	am.atlases[name] = a
+	return a, nil
+}
+
+// TileMap loads a TMX file and every tileset image it references. Image
+// sources are relative to the TMX file.
+func (am *AssetManager) TileMap(name string) (*TileMap, error) {
+	data, err := am.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return am.TileMapData(name, data)
+}
+
+// TileMapData loads a TMX file that's already in memory, e.g. a generated
+// one. Image sources are relative to name as if the file were there.
+func (am *AssetManager) TileMapData(name string, data []byte) (*TileMap, error) {
+	sources, err := tmxImageSources(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	images := make(map[string]*ebiten.Image)
+	for _, src := range sources {
+		images[src] = am.Image(path.Join(path.Dir(name), src))
+	}
+
+	return NewTileMap(data, images)
+}
+
+// tmxImageSources lists the tileset image sources in a TMX file as written
+func tmxImageSources(tmxData []byte) ([]string, error) {
+	m, err := tiled.LoadReader("map.tmx", bytes.NewReader(tmxData))
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	for _, ts := range m.Tilesets {
+		if ts.Image != nil {
+			sources = append(sources, ts.Image.Source)
+		}
+		for _, tile := range ts.Tiles {
+			if tile.Image != nil {
+				sources = append(sources, tile.Image.Source)
+			}
+		}
+	}
+	return sources, nil
+}
+
+// Missing lists every asset that failed to load so far
+func (am *AssetManager) Missing() []string {
+	var names []string
+	for name, err := range am.missing {
+		names = append(names, fmt.Sprintf("%s (%v)", name, err))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckMissing returns an error listing every missing asset, if any
+func (am *AssetManager) CheckMissing() error {
+	missing := am.Missing()
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d missing asset(s):\n  %s", len(missing), strings.Join(missing, "\n  "))
+}
+
+func (am *AssetManager) watch(name string) {
+	if am.devDir == "" {
+		return
+	}
+	if info, err := os.Stat(filepath.Join(am.devDir, filepath.FromSlash(name))); err == nil {
+		am.modTimes[name] = info.ModTime()
+	}
+}
+
+// Update checks watched files for changes in dev mode. Images are reloaded
+// in place so everything holding them picks up the change; other files are
+// passed to OnReload.
+func (am *AssetManager) Update() {
+	if am.devDir == "" {
+		return
+	}
+	am.reloadTimer++
+	if am.reloadTimer < hotReloadInterval {
+		return
+	}
+	am.reloadTimer = 0
+
+	for name, modTime := range am.modTimes {
+		info, err := os.Stat(filepath.Join(am.devDir, filepath.FromSlash(name)))
+		if err != nil || !info.ModTime().After(modTime) {
+			continue
+		}
+		am.modTimes[name] = info.ModTime()
+
+		if img, ok := am.images[name]; ok {
+			am.reloadImage(name, img)
+		}
+		log.Printf("Reloaded %s", name)
+		if am.OnReload != nil {
+			am.OnReload(name)
+		}
+	}
+}
+
+func (am *AssetManager) reloadImage(name string, img *ebiten.Image) {
+	fresh, err := am.decodeImage(name)
+	if err != nil {
+		log.Printf("Warning: Failed to reload %s: %v", name, err)
+		return
+	}
+	if fresh.Bounds() != img.Bounds() {
+		log.Printf("Warning: %s changed size from %v to %v, restart to pick it up", name, img.Bounds().Size(), fresh.Bounds().Size())
+		return
+	}
+	img.Clear()
+	img.DrawImage(fresh, nil)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"math"
+	"path"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Atlas is a sprite sheet plus the frame and clip metadata exported next to
+// it by Aseprite ("Export Sprite Sheet" with JSON data, array or hash) or
+// TexturePacker (JSON array or hash).
+type Atlas struct {
+	Image  *ebiten.Image
+	Frames []AtlasFrame
+	Tags   map[string]AtlasTag
+}
+
+type AtlasFrame struct {
+	Name     string
+	Rect     image.Rectangle // area of the sheet
+	Offset   image.Point     // where a trimmed frame sits in the untrimmed sprite
+	Pivot    image.Point     // anchor point in untrimmed sprite pixels
+	Duration int             // ms, 0 if the exporter doesn't write one
+}
+
+// AtlasTag is a named range of frames, i.e. one clip
+type AtlasTag struct {
+	Name      string
+	From, To  int
+	Direction string // forward, reverse or pingpong
+	Loop      bool
+}
+
+type atlasRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+type atlasJSONFrame struct {
+	Filename         string    `json:"filename"`
+	Frame            atlasRect `json:"frame"`
+	SpriteSourceSize atlasRect `json:"spriteSourceSize"`
+	SourceSize       struct {
+		W int `json:"w"`
+		H int `json:"h"`
+	} `json:"sourceSize"`
+	Duration int `json:"duration"`
+	Pivot    *struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	} `json:"pivot"` // TexturePacker, normalized 0..1
+}
+
+type atlasJSON struct {
+	Frames json.RawMessage `json:"frames"`
+	Meta   struct {
+		Image     string `json:"image"`
+		FrameTags []struct {
+			Name      string `json:"name"`
+			From      int    `json:"from"`
+			To        int    `json:"to"`
+			Direction string `json:"direction"`
+			Repeat    string `json:"repeat"` // Aseprite 1.3+, "" means loop forever
+		} `json:"frameTags"`
+		Slices []struct {
+			Name string `json:"name"`
+			Keys []struct {
+				Frame int `json:"frame"`
+				Pivot *struct {
+					X int `json:"x"`
+					Y int `json:"y"`
+				} `json:"pivot"`
+				Bounds atlasRect `json:"bounds"`
+			} `json:"keys"`
+		} `json:"slices"`
+	} `json:"meta"`
+}
+
+// LoadAtlas reads an atlas JSON file and loads the sheet it points to with
+// loadImage. The image path in the JSON is relative to the JSON file.
+func LoadAtlas(fsys fs.FS, file string, loadImage func(string) *ebiten.Image) (*Atlas, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, frames, err := parseAtlasJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if meta.Meta.Image == "" {
+		return nil, fmt.Errorf("%s: no meta.image", file)
+	}
+
+	a := &Atlas{
+		Image: loadImage(path.Join(path.Dir(file), meta.Meta.Image)),
+		Tags:  make(map[string]AtlasTag),
+	}
+
+	for _, f := range frames {
+		frame := AtlasFrame{
+			Name:     f.Filename,
+			Rect:     image.Rect(f.Frame.X, f.Frame.Y, f.Frame.X+f.Frame.W, f.Frame.Y+f.Frame.H),
+			Offset:   image.Pt(f.SpriteSourceSize.X, f.SpriteSourceSize.Y),
+			Duration: f.Duration,
+		}
+		if f.Pivot != nil {
+			w, h := f.SourceSize.W, f.SourceSize.H
+			if w == 0 {
+				w, h = f.Frame.W, f.Frame.H
+			}
+			frame.Pivot = image.Pt(int(math.Round(f.Pivot.X*float64(w))), int(math.Round(f.Pivot.Y*float64(h))))
+		}
+		a.Frames = append(a.Frames, frame)
+	}
+
+	// Aseprite stores pivots on slice keys, each key applying from its frame on
+	for _, s := range meta.Meta.Slices {
+		for k, key := range s.Keys {
+			if key.Pivot == nil {
+				continue
+			}
+			end := len(a.Frames)
+			if k+1 < len(s.Keys) {
+				end = s.Keys[k+1].Frame
+			}
+			for i := key.Frame; i < end && i < len(a.Frames); i++ {
+				a.Frames[i].Pivot = image.Pt(key.Bounds.X+key.Pivot.X, key.Bounds.Y+key.Pivot.Y)
+			}
+		}
+	}
+
+	for _, t := range meta.Meta.FrameTags {
+		if t.From < 0 || t.To >= len(a.Frames) || t.From > t.To {
+			return nil, fmt.Errorf("%s: tag %q frames %d-%d out of range", file, t.Name, t.From, t.To)
+		}
+		dir := t.Direction
+		if dir == "" {
+			dir = "forward"
+		}
+		a.Tags[t.Name] = AtlasTag{Name: t.Name, From: t.From, To: t.To, Direction: dir, Loop: t.Repeat == "" || t.Repeat == "0"}
+	}
+
+	return a, nil
+}
+
+// parseAtlasJSON accepts both the array and hash layouts of "frames". Hash
+// order is kept as written since frame indices in tags depend on it.
+func parseAtlasJSON(data []byte) (*atlasJSON, []atlasJSONFrame, error) {
+	var meta atlasJSON
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, nil, err
+	}
+
+	raw := bytes.TrimSpace(meta.Frames)
+	if len(raw) == 0 {
+		return nil, nil, fmt.Errorf("no frames")
+	}
+
+	var frames []atlasJSONFrame
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &frames); err != nil {
+			return nil, nil, err
+		}
+		return &meta, frames, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil { // opening {
+		return nil, nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var f atlasJSONFrame
+		if err := dec.Decode(&f); err != nil {
+			return nil, nil, err
+		}
+		f.Filename = tok.(string)
+		frames = append(frames, f)
+	}
+	return &meta, frames, nil
+}
+
+// tagFrames returns frame indices for a tag in play order
+func (a *Atlas) tagFrames(tag AtlasTag) []int {
+	var order []int
+	for i := tag.From; i <= tag.To; i++ {
+		order = append(order, i)
+	}
+	switch tag.Direction {
+	case "reverse":
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	case "pingpong":
+		for i := tag.To - 1; i > tag.From; i-- {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+func (a *Atlas) frameImage(i int) *ebiten.Image {
+	return a.Image.SubImage(a.Frames[i].Rect).(*ebiten.Image)
+}
+
+// Clip builds an animation clip from a tag. Frame durations come from the
+// atlas, converted to ticks.
+func (a *Atlas) Clip(tag string) (*AnimClip, error) {
+	return DirectionalClip([]*Atlas{a}, tag)
+}
+
+// DirectionalClip builds one clip from the same tag in several atlases, one
+// per facing direction. Timing and looping are taken from the first atlas.
+func DirectionalClip(atlases []*Atlas, tag string) (*AnimClip, error) {
+	clip := &AnimClip{events: make(map[int]string)}
+
+	for d, a := range atlases {
+		t, ok := a.Tags[tag]
+		if !ok {
+			return nil, fmt.Errorf("atlas has no tag %q", tag)
+		}
+		order := a.tagFrames(t)
+
+		frames := make([]*ebiten.Image, len(order))
+		offsets := make([]image.Point, len(order))
+		first := a.Frames[order[0]]
+		for n, i := range order {
+			f := a.Frames[i]
+			frames[n] = a.frameImage(i)
+			// Keep the pivot of every frame where the first frame's pivot is
+			offsets[n] = f.Offset.Add(first.Pivot).Sub(f.Pivot)
+		}
+		clip.frames = append(clip.frames, frames)
+		clip.offsets = append(clip.offsets, offsets)
+
+		if d == 0 {
+			clip.loop = t.Loop
+			for _, i := range order {
+				clip.durations = append(clip.durations, msToTicks(a.Frames[i].Duration))
+			}
+		} else if len(order) != len(clip.durations) {
+			return nil, fmt.Errorf("tag %q has %d frames in direction %d, want %d", tag, len(order), d, len(clip.durations))
+		}
+	}
+
+	return clip, nil
+}
+
+// MustClip is Clip for clips the game can't run without
+func (a *Atlas) MustClip(tag string) *AnimClip {
+	clip, err := a.Clip(tag)
+	if err != nil {
+		log.Fatal("Failed to build animation clip:", err)
+	}
+	return clip
+}
+
+// MustDirectionalClip is DirectionalClip for clips the game can't run without
+func MustDirectionalClip(atlases []*Atlas, tag string) *AnimClip {
+	clip, err := DirectionalClip(atlases, tag)
+	if err != nil {
+		log.Fatal("Failed to build animation clip:", err)
+	}
+	return clip
+}
+
+func msToTicks(ms int) int {
+	if ms <= 0 {
+		ms = 100 // TexturePacker doesn't export durations
+	}
+	ticks := int(math.Round(float64(ms) * float64(ebiten.DefaultTPS) / 1000))
+	if ticks < 1 {
+		ticks = 1
+	}
+	return ticks
+}
@@ -1,209 +1,104 @@
 package main
 
 import (
-	"bytes"
-	"io"
+	"fmt"
 	"log"
-
-	"github.com/hajimehoshi/ebiten/v2/audio"
-	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+	"math/rand"
+	"time"
 )
 
-const (
-	sampleRate = 48000
-)
+const sampleRate = 48000
 
 type AudioManager struct {
-	audioContext  *audio.Context
-	bgmPlayer     *audio.Player
-	eatSoundData  []byte
-	carHonkData   []byte
-	ouchSoundData []byte
+	assets  *AssetManager
+	backend AudioBackend
+	mixer   *Mixer
+	sounds  *SoundRegistry
+	music   *MusicPlayer
+
+	// Variants and pitch are picked with their own generator so sounds
+	// don't change what a seeded game does
+	rng *rand.Rand
 }
 
-func NewAudioManager() *AudioManager {
+func NewAudioManager(assets *AssetManager, backend AudioBackend) *AudioManager {
 	am := &AudioManager{
-		audioContext: audio.NewContext(sampleRate),
+		assets:  assets,
+		backend: backend,
+		mixer:   NewMixer(backend),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 
-	// Load background music
-	am.loadBackgroundMusic()
-
-	// Load eat sound effect
-	am.loadEatSound()
-
-	// Load car honk sound
-	am.loadCarHonkSound()
-
-	// Load ouch sound
-	am.loadOuchSound()
-
-	return am
-}
-
-func (am *AudioManager) loadBackgroundMusic() {
-	// Load the MP3 from embedded filesystem
-	data, err := assetsFS.ReadFile("assets/sounds/cottagecore-17463.mp3")
+	// Sound effects are decoded once and played through the mixer. Music
+	// is streamed by the music player. Without a manifest the game just runs
+	// silently.
+	sounds, err := LoadSoundRegistry(assets.FS(), soundsFile)
 	if err != nil {
-		log.Printf("Failed to load background music: %v", err)
-		return
+		log.Printf("Failed to load sound manifest: %v", err)
+		sounds = &SoundRegistry{}
 	}
-
-	// Decode MP3
-	stream, err := mp3.DecodeWithoutResampling(bytes.NewReader(data))
-	if err != nil {
-		log.Printf("Failed to decode background music: %v", err)
-		return
+	am.sounds = sounds
+	for _, file := range sounds.Files() {
+		am.loadSound(file)
 	}
+	am.music = NewMusicPlayer(am)
 
-	// Create an infinite loop
-	loopStream := audio.NewInfiniteLoop(stream, stream.Length())
-
-	// Create player
-	player, err := am.audioContext.NewPlayer(loopStream)
-	if err != nil {
-		log.Printf("Failed to create music player: %v", err)
-		return
-	}
-
-	am.bgmPlayer = player
-}
-
-func (am *AudioManager) loadEatSound() {
-	// Load the MP3 from embedded filesystem
-	data, err := assetsFS.ReadFile("assets/sounds/wet-squelchy-impact-352302.mp3")
-	if err != nil {
-		log.Printf("Failed to load eat sound: %v", err)
-		return
-	}
-
-	// Decode MP3
-	stream, err := mp3.DecodeWithoutResampling(bytes.NewReader(data))
-	if err != nil {
-		log.Printf("Failed to decode eat sound: %v", err)
-		return
-	}
-
-	// Read all data into memory for quick playback
-	eatData, err := io.ReadAll(stream)
-	if err != nil {
-		log.Printf("Failed to read eat sound data: %v", err)
-		return
-	}
-
-	am.eatSoundData = eatData
-}
-
-func (am *AudioManager) PlayBackgroundMusic() {
-	if am.bgmPlayer != nil && !am.bgmPlayer.IsPlaying() {
-		am.bgmPlayer.Play()
-	}
-}
-
-func (am *AudioManager) StopBackgroundMusic() {
-	if am.bgmPlayer != nil && am.bgmPlayer.IsPlaying() {
-		am.bgmPlayer.Pause()
-	}
+	return am
 }
 
-func (am *AudioManager) loadCarHonkSound() {
-	// Load the MP3 from embedded filesystem
-	data, err := assetsFS.ReadFile("assets/sounds/car-honk-386166.mp3")
-	if err != nil {
-		log.Printf("Failed to load car honk sound: %v", err)
-		return
-	}
-
-	// Decode MP3
-	stream, err := mp3.DecodeWithoutResampling(bytes.NewReader(data))
+// loadSound decodes a sound file into memory for quick playback
+func (am *AudioManager) loadSound(file string) {
+	data, err := am.assets.ReadFile(file)
 	if err != nil {
-		log.Printf("Failed to decode car honk sound: %v", err)
+		log.Printf("Failed to load sound: %v", err)
 		return
 	}
 
-	// Read all data into memory for quick playback
-	carHonkData, err := io.ReadAll(stream)
+	pcm, err := decodeSound(file, data)
 	if err != nil {
-		log.Printf("Failed to read car honk sound data: %v", err)
+		log.Printf("Failed to decode sound %s: %v", file, err)
 		return
 	}
 
-	am.carHonkData = carHonkData
+	am.mixer.Load(file, pcm)
 }
 
-func (am *AudioManager) loadOuchSound() {
-	// Load the MP3 from embedded filesystem
-	data, err := assetsFS.ReadFile("assets/sounds/ouchnoise-96832.mp3")
-	if err != nil {
-		log.Printf("Failed to load ouch sound: %v", err)
-		return
-	}
-
-	// Decode MP3
-	stream, err := mp3.DecodeWithoutResampling(bytes.NewReader(data))
-	if err != nil {
-		log.Printf("Failed to decode ouch sound: %v", err)
-		return
-	}
-
-	// Read all data into memory for quick playback
-	ouchData, err := io.ReadAll(stream)
-	if err != nil {
-		log.Printf("Failed to read ouch sound data: %v", err)
-		return
-	}
-
-	am.ouchSoundData = ouchData
+// SetMuted turns all sound off or back on
+func (am *AudioManager) SetMuted(muted bool) {
+	am.mixer.SetMuted(muted)
 }
 
-func (am *AudioManager) PlayEatSound() {
-	if am.eatSoundData == nil {
-		return
-	}
-
-	// Create a new player each time for the sound effect
-	// This allows multiple sounds to play simultaneously if needed
-	stream := bytes.NewReader(am.eatSoundData)
-	player, err := am.audioContext.NewPlayer(stream)
-	if err != nil {
-		log.Printf("Failed to create eat sound player: %v", err)
-		return
-	}
-
-	// Play the sound
-	player.Play()
-
-	// Note: The player will be garbage collected after the sound finishes
+// Update runs the music fades, once per tick
+func (am *AudioManager) Update() {
+	am.backend.Update()
+	am.music.Update()
 }
 
-func (am *AudioManager) PlayCarHonkSound() {
-	if am.carHonkData == nil {
-		return
-	}
-
-	stream := bytes.NewReader(am.carHonkData)
-	player, err := am.audioContext.NewPlayer(stream)
-	if err != nil {
-		log.Printf("Failed to create car honk player: %v", err)
-		return
-	}
-
-	player.Play()
+// Play plays a sound event from the manifest, e.g. "eat". Unknown events
+// are ignored, so anything can try to play a sound whether or not there is
+// one.
+func (am *AudioManager) Play(event string) *Voice {
+	return am.PlayAt(event, 1, 0)
 }
 
-func (am *AudioManager) PlayOuchSound() {
-	if am.ouchSoundData == nil {
-		return
+// PlayAt plays a sound event quieter by gain and panned between -1 (left)
+// and 1 (right), for sounds that come from somewhere in the world
+func (am *AudioManager) PlayAt(event string, gain, pan float64) *Voice {
+	ev := am.sounds.Events[event]
+	if ev == nil {
+		return nil
 	}
 
-	stream := bytes.NewReader(am.ouchSoundData)
-	player, err := am.audioContext.NewPlayer(stream)
-	if err != nil {
-		log.Printf("Failed to create ouch sound player: %v", err)
-		return
+	file := ev.Files[am.rng.Intn(len(ev.Files))]
+	sound := file
+	if pitch := randomPitch(am.rng.Float64(), ev.PitchJitter); pitch != 1 {
+		// Pitched copies are made the first time they're needed
+		sound = fmt.Sprintf("%s@%.2f", file, pitch)
+		if !am.mixer.Has(sound) && am.mixer.Has(file) {
+			am.mixer.Load(sound, pitchShift(am.mixer.sounds[file], pitch))
+		}
 	}
-
-	player.Play()
+	return am.mixer.Play(ev.bus, event, sound, ev.Volume*gain, pan)
 }
 
 //audio functions implemented with DeepseekR1
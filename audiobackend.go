@@ -0,0 +1,188 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+// AudioPlayer is one sound being played by a backend. *audio.Player is one.
+type AudioPlayer interface {
+	Play()
+	Pause()
+	IsPlaying() bool
+	Rewind() error
+	SetVolume(volume float64)
+	Close() error
+}
+
+// AudioBackend makes players for 16-bit stereo PCM at sampleRate. The name
+// says what the player is for, e.g. "eat" or "music meadow". Update is
+// called once per tick.
+type AudioBackend interface {
+	NewPlayer(name string, src io.Reader) (AudioPlayer, error)
+	Update()
+}
+
+// newAudioBackend picks the backend for the -audio flag: "ebiten" plays
+// through the sound card, "null" records what would have played without
+// making a sound, and "auto" uses ebiten unless there's no sound card.
+func newAudioBackend(kind string) AudioBackend {
+	if kind == "auto" {
+		kind = "ebiten"
+		if !audioDeviceAvailable() {
+			log.Printf("No audio device found, running without sound")
+			kind = "null"
+		}
+	}
+	if kind == "null" {
+		return NewRecordingBackend()
+	}
+	return &ebitenBackend{ctx: audio.NewContext(sampleRate)}
+}
+
+// audioDeviceAvailable guesses whether there's a sound card to play on.
+// Ebiten can't tell us up front: it opens the device on the first update
+// and a failure ends the game. Only Linux is checked, where containers and
+// CI machines usually have no ALSA devices at all.
+func audioDeviceAvailable() bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+	cards, err := os.ReadFile("/proc/asound/cards")
+	if err != nil {
+		return false
+	}
+	return !strings.Contains(string(cards), "no soundcards")
+}
+
+type ebitenBackend struct {
+	ctx *audio.Context
+}
+
+func (b *ebitenBackend) NewPlayer(name string, src io.Reader) (AudioPlayer, error) {
+	return b.ctx.NewPlayer(src)
+}
+
+// Update does nothing, ebiten plays on its own goroutine
+func (b *ebitenBackend) Update() {}
+
+// recordLimit is how many played sounds a RecordingBackend remembers
+const recordLimit = 1000
+
+// bytesPerTick is how much PCM a recorded player gets through each tick
+const bytesPerTick = sampleRate * pcmFrameSize / ebiten.DefaultTPS
+
+// RecordingBackend plays nothing but keeps a list of every player started,
+// by name, so headless runs and tests can check which sounds the game
+// asked for. Its players read their sound at the real rate, one tick's
+// worth per Update, and stop at the end of it like a real player would.
+type RecordingBackend struct {
+	mu      sync.Mutex
+	played  []string
+	playing []*recordedPlayer
+}
+
+func NewRecordingBackend() *RecordingBackend {
+	return &RecordingBackend{}
+}
+
+func (b *RecordingBackend) NewPlayer(name string, src io.Reader) (AudioPlayer, error) {
+	return &recordedPlayer{backend: b, name: name, src: src}, nil
+}
+
+// Update moves every playing player on by a tick
+func (b *RecordingBackend) Update() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buf := make([]byte, bytesPerTick)
+	playing := b.playing[:0]
+	for _, p := range b.playing {
+		if !p.playing {
+			continue
+		}
+		if n, err := io.ReadFull(p.src, buf); n == 0 && err != nil {
+			p.playing = false
+			continue
+		}
+		playing = append(playing, p)
+	}
+	b.playing = playing
+}
+
+// Played lists the names of the players started so far, oldest first
+func (b *RecordingBackend) Played() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.played...)
+}
+
+// Reset forgets everything played so far
+func (b *RecordingBackend) Reset() {
+	b.mu.Lock()
+	b.played = nil
+	b.mu.Unlock()
+}
+
+// start records a player starting
+func (b *RecordingBackend) start(p *recordedPlayer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if p.playing {
+		return
+	}
+	p.playing = true
+	b.playing = append(b.playing, p)
+	b.played = append(b.played, p.name)
+	if len(b.played) > recordLimit {
+		b.played = b.played[len(b.played)-recordLimit:]
+	}
+}
+
+// recordedPlayer's playing flag is guarded by its backend's lock
+type recordedPlayer struct {
+	backend *RecordingBackend
+	name    string
+	src     io.Reader
+	playing bool
+	volume  float64
+}
+
+func (p *recordedPlayer) Play() {
+	p.backend.start(p)
+}
+
+func (p *recordedPlayer) Pause() {
+	p.backend.mu.Lock()
+	p.playing = false
+	p.backend.mu.Unlock()
+}
+
+func (p *recordedPlayer) IsPlaying() bool {
+	p.backend.mu.Lock()
+	defer p.backend.mu.Unlock()
+	return p.playing
+}
+
+func (p *recordedPlayer) Rewind() error {
+	if s, ok := p.src.(io.Seeker); ok {
+		_, err := s.Seek(0, io.SeekStart)
+		return err
+	}
+	return nil
+}
+
+func (p *recordedPlayer) SetVolume(volume float64) {
+	p.volume = volume
+}
+
+func (p *recordedPlayer) Close() error {
+	p.Pause()
+	return nil
+}
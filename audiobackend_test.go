@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// newTestAudio makes an AudioManager on the null backend with two events
+// whose sounds are silent PCM of the given lengths in ticks
+func newTestAudio(t *testing.T, eatTicks, stingerTicks int) (*AudioManager, *RecordingBackend) {
+	t.Helper()
+	backend := NewRecordingBackend()
+	am := &AudioManager{
+		backend: backend,
+		mixer:   NewMixer(backend),
+		sounds: &SoundRegistry{Events: map[string]*SoundEvent{
+			"eat":     {Files: []string{"eat.wav"}, Volume: 1, bus: BusSFX},
+			"victory": {Files: []string{"victory.ogg"}, Volume: 1, bus: BusMusic},
+		}},
+		rng: rand.New(rand.NewSource(1)),
+	}
+	am.mixer.Load("eat.wav", make([]byte, eatTicks*bytesPerTick))
+	am.mixer.Load("victory.ogg", make([]byte, stingerTicks*bytesPerTick))
+	am.music = NewMusicPlayer(am)
+	return am, backend
+}
+
+func TestRecordingBackendPlaysForTheClipLength(t *testing.T) {
+	am, backend := newTestAudio(t, 10, 10)
+
+	v := am.Play("eat")
+	if v == nil {
+		t.Fatal("Play returned no voice")
+	}
+	for tick := 0; tick < 10; tick++ {
+		if !v.Playing() {
+			t.Fatalf("stopped after %d ticks, want 10", tick)
+		}
+		am.Update()
+	}
+	am.Update()
+	if v.Playing() {
+		t.Fatal("still playing after the clip ended")
+	}
+
+	// A finished player is reused and starts again from the beginning
+	v = am.Play("eat")
+	am.Update()
+	if !v.Playing() {
+		t.Fatal("reused player didn't play")
+	}
+	if got, want := backend.Played(), []string{"eat", "eat"}; !slices.Equal(got, want) {
+		t.Errorf("played %v, want %v", got, want)
+	}
+}
+
+func TestRecordingBackendRecordsWhileMuted(t *testing.T) {
+	am, backend := newTestAudio(t, 10, 10)
+	am.SetMuted(true)
+
+	if am.Play("eat") == nil {
+		t.Fatal("muted Play returned no voice")
+	}
+	am.Play("nosuchsound")
+	if got, want := backend.Played(), []string{"eat"}; !slices.Equal(got, want) {
+		t.Errorf("played %v, want %v", got, want)
+	}
+}
+
+func TestStingerDucksMusicUntilItEnds(t *testing.T) {
+	stingerTicks := 2 * ebiten.DefaultTPS
+	am, backend := newTestAudio(t, 10, stingerTicks)
+	mp := am.music
+
+	mp.Stinger("victory")
+	for tick := 0; tick <= duckTicks; tick++ {
+		am.Update()
+	}
+	if mp.duck != duckGain {
+		t.Fatalf("music at %.2f under the stinger, want %.2f", mp.duck, duckGain)
+	}
+
+	for tick := duckTicks + 1; tick <= stingerTicks; tick++ {
+		am.Update()
+	}
+	if mp.stinger.Playing() {
+		t.Fatal("stinger still playing after it ended")
+	}
+	for tick := 0; tick <= duckTicks; tick++ {
+		am.Update()
+	}
+	if mp.duck != 1 {
+		t.Errorf("music at %.2f after the stinger, want 1", mp.duck)
+	}
+	if got, want := backend.Played(), []string{"victory"}; !slices.Equal(got, want) {
+		t.Errorf("played %v, want %v", got, want)
+	}
+}
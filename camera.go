@@ -11,9 +11,12 @@ type Camera struct {
 	ViewportWidth  int
 	ViewportHeight int
 	Follow         Follow
+
+	// Top-left of the visible area as of the last Draw
+	X, Y int
 }
 
-//positioning
+// positioning
 type Follow struct {
 	W int // X position
 	H int // Y position
@@ -53,6 +56,9 @@ func (c *Camera) Draw(world, screen *ebiten.Image) {
 		cameraY = worldHeight - c.ViewportHeight
 	}
 
+	c.X = cameraX
+	c.Y = cameraY
+
 	//subimage
 	sx := cameraX
 	sy := cameraY
@@ -77,3 +83,14 @@ func (c *Camera) Draw(world, screen *ebiten.Image) {
 	op := &ebiten.DrawImageOptions{}
 	screen.DrawImage(world.SubImage(image.Rect(sx, sy, sx+sw, sy+sh)).(*ebiten.Image), op)
 }
+
+// WorldToScreen converts world coordinates to screen coordinates using the
+// position from the last Draw
+func (c *Camera) WorldToScreen(x, y float64) (float64, float64) {
+	return x - float64(c.X), y - float64(c.Y)
+}
+
+// ScreenToWorld is the reverse of WorldToScreen
+func (c *Camera) ScreenToWorld(x, y float64) (float64, float64) {
+	return x + float64(c.X), y + float64(c.Y)
+}
@@ -1,61 +1,46 @@
 package main
 
 import (
-	"image"
 	"math"
-	"math/rand"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
 type Car struct {
-	spriteSheet  *ebiten.Image
-	frames       []*ebiten.Image // Individual frames extracted from sheet
-	currentFrame int
-	frameCount   int
-	animTimer    int
-	x, y         float64
-	speedX       float64
-	speedY       float64
-	width        int
-	height       int
-	changeTimer  int
-	maxSpeed     float64
+	anim        *AnimStateMachine
+	x, y        float64
+	speedX      float64
+	speedY      float64
+	width       int
+	height      int
+	changeTimer int
+	maxSpeed    float64
+	honkTimer   int    // ticks until it honks, set by the spatial audio
+	nearby      bool   // within nearMissMargin of the cat, see NearMiss
+	lane        string // LaneHorizontal or LaneVertical keeps it on a road, "" roams
 }
 
-func NewCar(x, y float64, spriteSheet *ebiten.Image, maxSpeed float64) *Car {
-	sheetWidth := spriteSheet.Bounds().Dx()
-	var frameSize int
-	var gridSize int
-
-	if sheetWidth == 980 {
-		frameSize = 140
-		gridSize = 7
-	} else {
-		frameSize = 70
-		gridSize = 10
-	}
+const nearMissMargin = 16.0
 
-	frames := make([]*ebiten.Image, gridSize)
-	for i := 0; i < gridSize; i++ {
-		x := i * frameSize
-		rect := image.Rect(x, 0, x+frameSize, frameSize)
-		frames[i] = spriteSheet.SubImage(rect).(*ebiten.Image)
-	}
+// Lanes: a car on a road only drives back and forth along it
+const (
+	LaneHorizontal = "horizontal"
+	LaneVertical   = "vertical"
+)
 
+// NewCar needs an atlas with a "drive" clip
+func NewCar(x, y float64, atlas *Atlas, maxSpeed float64, lane string) *Car {
 	car := &Car{
-		spriteSheet:  spriteSheet,
-		frames:       frames,
-		frameCount:   gridSize,
-		currentFrame: 0,
-		x:            x,
-		y:            y,
-		width:        80,
-		height:       80,
-		maxSpeed:     maxSpeed,
-		changeTimer:  0,
-		animTimer:    0,
+		anim:        NewAnimStateMachine(),
+		x:           x,
+		y:           y,
+		width:       80,
+		height:      80,
+		maxSpeed:    maxSpeed,
+		changeTimer: 0,
+		lane:        lane,
 	}
+	car.anim.AddState("drive", atlas.MustClip("drive"))
 
 	// Set initial random direction
 	car.changeDirection()
@@ -64,16 +49,29 @@ func NewCar(x, y float64, spriteSheet *ebiten.Image, maxSpeed float64) *Car {
 }
 
 func (c *Car) changeDirection() {
-	angle := rand.Float64() * 2 * math.Pi           
-	speed := c.maxSpeed * (0.5 + rand.Float64()*0.5) 
+	if c.lane != "" {
+		// Keep to the road, either way along it
+		speed := c.maxSpeed * (0.5 + rng.Float64()*0.5)
+		if rng.Intn(2) == 0 {
+			speed = -speed
+		}
+		c.speedX, c.speedY = speed, 0
+		if c.lane == LaneVertical {
+			c.speedX, c.speedY = 0, speed
+		}
+		c.changeTimer = 120 + rng.Intn(180)
+		return
+	}
+
+	angle := rng.Float64() * 2 * math.Pi
+	speed := c.maxSpeed * (0.5 + rng.Float64()*0.5)
 	c.speedX = speed * math.Cos(angle)
 	c.speedY = speed * math.Sin(angle)
 
-	c.changeTimer = 120 + rand.Intn(180) 
+	c.changeTimer = 120 + rng.Intn(180)
 }
 
-
-//randomness
+// randomness
 func (c *Car) Update(mapWidth, mapHeight int) {
 	c.x += c.speedX
 	c.y += c.speedY
@@ -81,7 +79,7 @@ func (c *Car) Update(mapWidth, mapHeight int) {
 	if c.x < 0 {
 		c.x = 0
 		c.speedX = -c.speedX
-		c.changeTimer = 60 
+		c.changeTimer = 60
 	}
 	if c.y < 0 {
 		c.y = 0
@@ -98,11 +96,7 @@ func (c *Car) Update(mapWidth, mapHeight int) {
 		c.speedY = -c.speedY
 		c.changeTimer = 60
 	}
-	c.animTimer++
-	if c.animTimer >= 8 { 
-		c.animTimer = 0
-		c.currentFrame = (c.currentFrame + 1) % c.frameCount
-	}
+	c.anim.Update()
 
 	// Random direction changes
 	c.changeTimer--
@@ -112,27 +106,24 @@ func (c *Car) Update(mapWidth, mapHeight int) {
 }
 
 func (c *Car) Draw(target *ebiten.Image, cameraX, cameraY float64) {
-	if c.currentFrame >= len(c.frames) {
+	fw, fh := c.anim.FrameSize()
+	if fw == 0 || fh == 0 {
 		return
 	}
 
-	frame := c.frames[c.currentFrame]
-
 	op := &ebiten.DrawImageOptions{}
 
-	// Scale the car 
-	frameWidth := float64(frame.Bounds().Dx())
-	frameHeight := float64(frame.Bounds().Dy())
-	scaleX := float64(c.width) / frameWidth
-	scaleY := float64(c.height) / frameHeight
+	// Scale the car
+	scaleX := float64(c.width) / float64(fw)
+	scaleY := float64(c.height) / float64(fh)
 	op.GeoM.Scale(scaleX, scaleY)
 	angle := math.Atan2(c.speedY, c.speedX)
-	op.GeoM.Translate(-float64(c.width)/2, -float64(c.height)/2) 
+	op.GeoM.Translate(-float64(c.width)/2, -float64(c.height)/2)
 	op.GeoM.Rotate(angle)
-	op.GeoM.Translate(float64(c.width)/2, float64(c.height)/2) 
+	op.GeoM.Translate(float64(c.width)/2, float64(c.height)/2)
 
 	op.GeoM.Translate(c.x-cameraX, c.y-cameraY)
-	target.DrawImage(frame, op)
+	c.anim.Draw(target, op, 0)
 }
 
 func (c *Car) CheckCollision(px, py, pw, ph float64) bool {
@@ -141,4 +132,15 @@ func (c *Car) CheckCollision(px, py, pw, ph float64) bool {
 		py < c.y+float64(c.height) &&
 		py+ph > c.y
 }
+
+// NearMiss is true on the tick the car gets clear of the cat after passing
+// within nearMissMargin of its hitbox without touching it
+func (c *Car) NearMiss(px, py, pw, ph float64) bool {
+	m := nearMissMargin
+	near := c.CheckCollision(px-m, py-m, pw+2*m, ph+2*m)
+	missed := c.nearby && !near
+	c.nearby = near
+	return missed
+}
+
 //car animation randomness added through DeepseekR1
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	consoleHeight = 240
+	consoleLines  = 200 // scrollback kept
+)
+
+// Command is one console command. Run gets the words after the command
+// name; an error is printed back to the console.
+type Command struct {
+	Name  string
+	Usage string // arguments, e.g. "<x> <y>"
+	Help  string
+	Cheat bool // using it stops the run from setting a personal best
+	Run   func(g *Game, args []string) error
+}
+
+// Console is the drop-down command line opened with the backtick key. The
+// game is paused while it's open. Anything can add commands with Register.
+type Console struct {
+	open     bool
+	input    string
+	output   []string
+	history  []string
+	histPos  int
+	commands map[string]*Command
+}
+
+func NewConsole() *Console {
+	return &Console{commands: make(map[string]*Command)}
+}
+
+// Register adds a command, replacing any command with the same name
+func (c *Console) Register(cmd *Command) {
+	c.commands[cmd.Name] = cmd
+}
+
+func (c *Console) Print(format string, args ...any) {
+	c.output = append(c.output, strings.Split(fmt.Sprintf(format, args...), "\n")...)
+	if len(c.output) > consoleLines {
+		c.output = c.output[len(c.output)-consoleLines:]
+	}
+}
+
+// Exec runs one line of input
+func (c *Console) Exec(g *Game, line string) {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return
+	}
+	c.Print("> %s", line)
+
+	cmd := c.commands[strings.ToLower(words[0])]
+	if cmd == nil {
+		c.Print("Unknown command %q, try help", words[0])
+		return
+	}
+	// Cheats disqualify the run before they run, so nothing they set off
+	// counts, but a typo or a bad argument doesn't cost the run
+	runCounts, cheated := g.runCounts, g.cheated
+	if cmd.Cheat {
+		g.disqualifyRun()
+	}
+	if err := cmd.Run(g, words[1:]); err != nil {
+		g.runCounts, g.cheated = runCounts, cheated
+		c.Print("%s: %v", cmd.Name, err)
+		if cmd.Usage != "" {
+			c.Print("usage: %s %s", cmd.Name, cmd.Usage)
+		}
+	}
+}
+
+func (g *Game) updateConsole() {
+	c := g.console
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackquote) || inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		c.open = false
+		return
+	}
+
+	for _, r := range ebiten.AppendInputChars(nil) {
+		if r != '`' {
+			c.input += string(r)
+		}
+	}
+	if repeatingKeyPressed(ebiten.KeyBackspace) && len(c.input) > 0 {
+		runes := []rune(c.input)
+		c.input = string(runes[:len(runes)-1])
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) && c.histPos > 0 {
+		c.histPos--
+		c.input = c.history[c.histPos]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) && c.histPos < len(c.history) {
+		c.histPos++
+		c.input = ""
+		if c.histPos < len(c.history) {
+			c.input = c.history[c.histPos]
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		line := strings.TrimSpace(c.input)
+		c.input = ""
+		if line != "" {
+			c.history = append(c.history, line)
+		}
+		c.histPos = len(c.history)
+		c.Exec(g, line)
+	}
+}
+
+// repeatingKeyPressed is true on the first tick a key is down and then
+// repeatedly while it's held
+func repeatingKeyPressed(key ebiten.Key) bool {
+	const (
+		delay    = 30
+		interval = 3
+	)
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || (d >= delay && (d-delay)%interval == 0)
+}
+
+func (c *Console) Draw(screen *ebiten.Image) {
+	if !c.open {
+		return
+	}
+
+	vector.FillRect(screen, 0, 0, screenWidth, consoleHeight, color.RGBA{0, 0, 0, 210}, false)
+	vector.StrokeLine(screen, 0, consoleHeight, screenWidth, consoleHeight, 1, color.RGBA{120, 120, 120, 255}, false)
+
+	lineHeight := 15
+	y := consoleHeight - 10
+	cursor := ""
+	if ebiten.Tick()/30%2 == 0 {
+		cursor = "_"
+	}
+	text.Draw(screen, "> "+c.input+cursor, basicfont.Face7x13, 10, y, color.RGBA{255, 255, 100, 255})
+
+	for i := len(c.output) - 1; i >= 0; i-- {
+		y -= lineHeight
+		if y < lineHeight {
+			break
+		}
+		text.Draw(screen, c.output[i], basicfont.Face7x13, 10, y, color.RGBA{220, 220, 220, 255})
+	}
+}
+
+// registerCommands adds the built-in commands
+func (g *Game) registerCommands() {
+	c := g.console
+
+	c.Register(&Command{Name: "help", Usage: "[command]", Help: "list commands or show one command's usage",
+		Run: func(g *Game, args []string) error {
+			if len(args) > 0 {
+				cmd := c.commands[strings.ToLower(args[0])]
+				if cmd == nil {
+					return fmt.Errorf("no command %q", args[0])
+				}
+				c.Print("%s %s - %s", cmd.Name, cmd.Usage, cmd.Help)
+				return nil
+			}
+			var names []string
+			for name := range c.commands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				c.Print("%-10s %s", name, c.commands[name].Help)
+			}
+			return nil
+		}})
+
+	c.Register(&Command{Name: "tp", Cheat: true, Usage: "[<x> <y>]", Help: "teleport the cat to a map position, or to the mouse cursor",
+		Run: func(g *Game, args []string) error {
+			x, y := g.cursorWorld()
+			if len(args) > 0 {
+				nums, err := parseFloats(args, 2)
+				if err != nil {
+					return err
+				}
+				x, y = nums[0], nums[1]
+			}
+			g.player.x = x - float64(g.player.width)/2
+			g.player.y = y - float64(g.player.height)/2
+			g.player.clampToMap(g.tileMap.Width(), g.tileMap.Height())
+			c.Print("Teleported to %.0f, %.0f", g.player.x, g.player.y)
+			return nil
+		}})
+
+	c.Register(&Command{Name: "lives", Cheat: true, Usage: "<n>", Help: "set the number of lives",
+		Run: func(g *Game, args []string) error {
+			n, err := parseInt(args)
+			if err != nil {
+				return err
+			}
+			if n < 1 {
+				return fmt.Errorf("need at least 1 life")
+			}
+			g.lives = n
+			return nil
+		}})
+
+	c.Register(&Command{Name: "fish", Cheat: true, Usage: "<n>", Help: "add n fish to the collected count",
+		Run: func(g *Game, args []string) error {
+			n, err := parseInt(args)
+			if err != nil {
+				return err
+			}
+			g.applyEffect(&Effect{GiveFish: n})
+			c.Print("Fish collected: %d", g.itemsCollected)
+			return nil
+		}})
+
+	c.Register(&Command{Name: "unlock", Cheat: true, Help: "unlock the portal",
+		Run: func(g *Game, args []string) error {
+			g.applyEffect(&Effect{UnlockPortal: true})
+			return nil
+		}})
+
+	c.Register(&Command{Name: "level", Cheat: true, Usage: "<n> | <file.tmx>", Help: "jump to a level, or play a TMX file from disk",
+		Run: func(g *Game, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("missing level")
+			}
+			// Also works from the game over, results and title screens
+			play := func() {
+				g.state = StatePlaying
+				if g.lives <= 0 {
+					g.lives = g.options.Lives
+				}
+				g.itemsCollected = 0
+				g.loadLevel(g.currentLevel)
+			}
+			if n, err := strconv.Atoi(args[0]); err == nil {
+				if n < 1 {
+					return fmt.Errorf("no level %d", n)
+				}
+				// Back to the -map file, if any, instead of one loaded here
+				g.mapFile, g.mapLevel = g.options.MapFile, g.options.Level
+				g.currentLevel = n
+				play()
+				c.Print("Loaded level %d", n)
+				return nil
+			}
+
+			// A TMX path, which may contain spaces
+			file := strings.Join(args, " ")
+			if _, err := loadMapFile(file); err != nil {
+				return err
+			}
+			g.mapFile, g.mapLevel = file, g.currentLevel
+			play()
+			c.Print("Loaded %s as level %d", file, g.currentLevel)
+			return nil
+		}})
+
+	c.Register(&Command{Name: "spawn", Cheat: true, Usage: "npc | car [police] | item [species]", Help: "spawn something at the mouse cursor",
+		Run: func(g *Game, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("spawn what?")
+			}
+			x, y := g.cursorWorld()
+			rest := strings.Join(args[1:], " ")
+
+			switch strings.ToLower(args[0]) {
+			case "npc":
+				g.npcs = append(g.npcs, g.newNPC(MapObject{Kind: "npc", X: x, Y: y, Props: map[string]string{"horizontal": "true"}}))
+			case "car":
+				atlas := limoAtlasPath
+				if rest == "police" {
+					atlas = policeAtlasPath
+				}
+				g.cars = append(g.cars, NewCar(x, y, g.loadAtlas(atlas), 2.0, ""))
+			case "item":
+				species := g.itemRegistry.PickGood()
+				if rest != "" {
+					species = g.itemRegistry.Get(rest)
+					if species == nil {
+						return fmt.Errorf("no species %q", rest)
+					}
+				}
+				g.items = append(g.items, NewSpeciesItem(x-32, y-32, species))
+			default:
+				return fmt.Errorf("can't spawn %q", args[0])
+			}
+			return nil
+		}})
+
+	c.Register(&Command{Name: "god", Cheat: true, Help: "toggle god mode (no lives lost)",
+		Run: func(g *Game, args []string) error {
+			g.godMode = !g.godMode
+			c.Print("God mode %v", g.godMode)
+			return nil
+		}})
+
+	c.Register(&Command{Name: "volume", Usage: "[music|sfx|ui] [0-100]", Help: "show or set the master or a bus volume",
+		Run: func(g *Game, args []string) error {
+			mixer := g.audioManager.mixer
+			if len(args) == 0 {
+				c.Print("master %.0f", mixer.Master()*100)
+				for i, name := range busNames {
+					c.Print("%-6s %.0f", name, mixer.Volume(Bus(i))*100)
+				}
+				c.Print("muted %v, %d sounds playing", mixer.Muted(), mixer.Voices())
+				return nil
+			}
+
+			bus, isBus := busByName(strings.ToLower(args[0]))
+			if isBus {
+				args = args[1:]
+			}
+			n, err := parseInt(args)
+			if err != nil {
+				return err
+			}
+			if n < 0 || n > 100 {
+				return fmt.Errorf("volume must be between 0 and 100")
+			}
+			if isBus {
+				mixer.SetVolume(bus, float64(n)/100)
+			} else {
+				mixer.SetMaster(float64(n) / 100)
+			}
+			g.storeSettings()
+			return nil
+		}})
+
+	c.Register(&Command{Name: "sounds", Usage: "[clear]", Help: "list the sounds played so far (with -audio null)",
+		Run: func(g *Game, args []string) error {
+			recorder, ok := g.audioManager.backend.(*RecordingBackend)
+			if !ok {
+				return fmt.Errorf("only recorded with -audio null")
+			}
+			if len(args) > 0 && strings.ToLower(args[0]) == "clear" {
+				recorder.Reset()
+				return nil
+			}
+			played := recorder.Played()
+			if len(played) > 20 {
+				c.Print("... %d earlier", len(played)-20)
+				played = played[len(played)-20:]
+			}
+			for _, name := range played {
+				c.Print("%s", name)
+			}
+			return nil
+		}})
+
+	c.Register(&Command{Name: "stats", Help: "show what happened since the game started",
+		Run: func(g *Game, args []string) error {
+			for _, line := range g.stats.Lines() {
+				c.Print("%s", line)
+			}
+			return nil
+		}})
+
+	c.Register(&Command{Name: "timescale", Cheat: true, Usage: "<x>", Help: "run the game at x times normal speed (0.1-4)",
+		Run: func(g *Game, args []string) error {
+			nums, err := parseFloats(args, 1)
+			if err != nil {
+				return err
+			}
+			if nums[0] < 0.1 || nums[0] > 4 {
+				return fmt.Errorf("time scale must be between 0.1 and 4")
+			}
+			// Everything is timed in ticks, so changing the tick rate scales it all
+			ebiten.SetTPS(int(nums[0] * ebiten.DefaultTPS))
+			c.Print("Time scale %.2f (%d TPS)", nums[0], ebiten.TPS())
+			return nil
+		}})
+}
+
+func parseInt(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("missing number")
+	}
+	return strconv.Atoi(args[0])
+}
+
+func parseFloats(args []string, n int) ([]float64, error) {
+	if len(args) < n {
+		return nil, fmt.Errorf("need %d numbers", n)
+	}
+	nums := make([]float64, n)
+	for i := range nums {
+		f, err := strconv.ParseFloat(args[i], 64)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = f
+	}
+	return nums, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.org/x/image/font/basicfont"
+)
+
+var (
+	debugPlayerColor = color.RGBA{0, 255, 0, 255}
+	debugSwipeColor  = color.RGBA{255, 255, 0, 255}
+	debugGoodColor   = color.RGBA{0, 200, 255, 255}
+	debugBadColor    = color.RGBA{255, 60, 60, 255}
+	debugCarColor    = color.RGBA{255, 140, 0, 255}
+	debugNPCColor    = color.RGBA{255, 0, 255, 255}
+	debugGridColor   = color.RGBA{255, 255, 255, 40}
+)
+
+// drawDebug draws hitboxes, patrol ranges and the tile grid over the world
+// plus an info panel (-debug or F3)
+func (g *Game) drawDebug(screen *ebiten.Image) {
+	if g.state == StatePlaying || g.state == StateDialogue || g.state == StateLifeLost {
+		g.drawDebugWorld(screen)
+	}
+	g.drawDebugPanel(screen)
+}
+
+func (g *Game) drawDebugWorld(screen *ebiten.Image) {
+	camX, camY := float64(g.camera.X), float64(g.camera.Y)
+
+	// Tile grid
+	tw, th := g.tileMap.TileSize()
+	for x := tw - g.camera.X%tw; x < screenWidth; x += tw {
+		vector.StrokeLine(screen, float32(x), 0, float32(x), screenHeight, 1, debugGridColor, false)
+	}
+	for y := th - g.camera.Y%th; y < screenHeight; y += th {
+		vector.StrokeLine(screen, 0, float32(y), screenWidth, float32(y), 1, debugGridColor, false)
+	}
+
+	// Map edges, visible when the camera is clamped against them
+	debugRect(screen, -camX, -camY, float64(g.tileMap.Width()), float64(g.tileMap.Height()), color.White)
+
+	for _, item := range g.items {
+		if item.collected {
+			continue
+		}
+		clr := debugGoodColor
+		if item.itemType == ItemBad {
+			clr = debugBadColor
+		}
+		debugRect(screen, item.x-camX, item.y-camY, float64(item.width), float64(item.height), clr)
+	}
+	if g.portal != nil {
+		clr := color.RGBA{128, 128, 128, 255}
+		if g.portalUnlocked {
+			clr = color.RGBA{180, 100, 255, 255}
+		}
+		debugRect(screen, g.portal.x-camX, g.portal.y-camY, float64(g.portal.width), float64(g.portal.height), clr)
+	}
+
+	for _, car := range g.cars {
+		debugRect(screen, car.x-camX, car.y-camY, float64(car.width), float64(car.height), debugCarColor)
+	}
+
+	for _, npc := range g.npcs {
+		cx, cy := npc.Center()
+		cx, cy = cx-camX, cy-camY
+		// Patrol path, relative to where the NPC is drawn now
+		if npc.moveHorz {
+			left := cx - (npc.x - npc.startX) - npc.moveRange
+			vector.StrokeLine(screen, float32(left), float32(cy), float32(left+2*npc.moveRange), float32(cy), 1, debugNPCColor, false)
+		} else {
+			top := cy - (npc.y - npc.startY) - npc.moveRange
+			vector.StrokeLine(screen, float32(cx), float32(top), float32(cx), float32(top+2*npc.moveRange), 1, debugNPCColor, false)
+		}
+		if npc.dialogueID != "" {
+			debugCircle(screen, cx, cy, talkDistance, debugNPCColor)
+		}
+	}
+
+	px, py, pw, ph := g.player.GetBounds()
+	debugRect(screen, px-camX, py-camY, pw, ph, debugPlayerColor)
+	if g.player.IsPouncing() {
+		sx, sy, sw, sh := g.player.SwipeBounds()
+		debugRect(screen, sx-camX, sy-camY, sw, sh, debugSwipeColor)
+	}
+
+	// Camera follow point
+	fx, fy := float32(float64(g.camera.Follow.W)-camX), float32(float64(g.camera.Follow.H)-camY)
+	vector.StrokeLine(screen, fx-6, fy, fx+6, fy, 1, color.White, false)
+	vector.StrokeLine(screen, fx, fy-6, fx, fy+6, 1, color.White, false)
+}
+
+func (g *Game) drawDebugPanel(screen *ebiten.Image) {
+	items := 0
+	for _, item := range g.items {
+		if !item.collected {
+			items++
+		}
+	}
+
+	wx, wy := g.cursorWorld()
+	tw, th := g.tileMap.TileSize()
+	tiles := g.tileMap.TilesAt(wx, wy)
+	if len(tiles) == 0 {
+		tiles = []string{"none"}
+	}
+
+	lines := []string{
+		fmt.Sprintf("FPS: %.0f  TPS: %.0f", ebiten.ActualFPS(), ebiten.ActualTPS()),
+		fmt.Sprintf("Items: %d  NPCs: %d  Cars: %d", items, len(g.npcs), len(g.cars)),
+		fmt.Sprintf("Player: %.0f, %.0f (%s)", g.player.x, g.player.y, g.player.anim.Current()),
+		fmt.Sprintf("Camera: %d, %d  Map: %dx%d", g.camera.X, g.camera.Y, g.tileMap.Width(), g.tileMap.Height()),
+		fmt.Sprintf("Cursor: %.0f, %.0f  Tile: %d, %d  Terrain: %s", wx, wy, int(wx)/tw, int(wy)/th, g.tileMap.TileProperty(int(wx)/tw, int(wy)/th, "terrain")),
+		"  " + strings.Join(tiles, "\n  "),
+	}
+	panel := strings.Join(lines, "\n")
+
+	h := float32(len(strings.Split(panel, "\n"))*16 + 8)
+	y := float32(screenHeight - 64 - h)
+	vector.FillRect(screen, 4, y, 300, h, color.RGBA{0, 0, 0, 170}, false)
+	text.Draw(screen, panel, basicfont.Face7x13, 10, int(y)+16, debugPlayerColor)
+}
+
+func debugRect(screen *ebiten.Image, x, y, w, h float64, clr color.Color) {
+	x0, y0, x1, y1 := float32(x), float32(y), float32(x+w), float32(y+h)
+	vector.StrokeLine(screen, x0, y0, x1, y0, 1, clr, false)
+	vector.StrokeLine(screen, x1, y0, x1, y1, 1, clr, false)
+	vector.StrokeLine(screen, x1, y1, x0, y1, 1, clr, false)
+	vector.StrokeLine(screen, x0, y1, x0, y0, 1, clr, false)
+}
+
+func debugCircle(screen *ebiten.Image, cx, cy, r float64, clr color.Color) {
+	const segments = 32
+	for i := 0; i < segments; i++ {
+		a0 := float64(i) / segments * 2 * math.Pi
+		a1 := float64(i+1) / segments * 2 * math.Pi
+		vector.StrokeLine(screen,
+			float32(cx+r*math.Cos(a0)), float32(cy+r*math.Sin(a0)),
+			float32(cx+r*math.Cos(a1)), float32(cy+r*math.Sin(a1)),
+			1, clr, false)
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	dialogueDir   = "assets/data/dialogue"
+	talkDistance  = 90.0
+	dialogueBoxH  = 170
+	dialogueWrapW = 72 // characters per line in the dialogue box
+)
+
+// DialogueCondition gates a start node or a choice on the current game state.
+// Zero values mean "don't care".
+type DialogueCondition struct {
+	MinFish *int   `json:"minFish,omitempty"`
+	MaxFish *int   `json:"maxFish,omitempty"`
+	Level   int    `json:"level,omitempty"`
+	Flag    string `json:"flag,omitempty"`
+	NotFlag string `json:"notFlag,omitempty"`
+
+	QuestActive string `json:"questActive,omitempty"`
+	QuestDone   string `json:"questDone,omitempty"`
+}
+
+// Effect is applied when the player picks a dialogue choice or finishes a
+// quest.
+type Effect struct {
+	GiveFish     int    `json:"giveFish,omitempty"`
+	FishSpecies  string `json:"fishSpecies,omitempty"` // of the given fish, the first good species if empty
+	UnlockPortal bool   `json:"unlockPortal,omitempty"`
+	GiveLife     int    `json:"giveLife,omitempty"`
+	SetFlag      string `json:"setFlag,omitempty"`
+	GiveQuest    string `json:"giveQuest,omitempty"`
+
+	Status        string  `json:"status,omitempty"` // status effect given to the cat
+	StatusSeconds float64 `json:"statusSeconds,omitempty"`
+}
+
+type DialogueChoice struct {
+	Text   string             `json:"text"`
+	Next   string             `json:"next"` // empty ends the conversation
+	If     *DialogueCondition `json:"if,omitempty"`
+	Effect *Effect            `json:"effect,omitempty"`
+}
+
+type DialogueNode struct {
+	Text    string             `json:"text"`
+	If      *DialogueCondition `json:"if,omitempty"` // only used for start nodes
+	Choices []DialogueChoice   `json:"choices"`
+}
+
+// Dialogue is one conversation tree. Start lists candidate entry nodes in
+// priority order; the first one whose condition passes is shown.
+type Dialogue struct {
+	ID      string                   `json:"id"`
+	Speaker string                   `json:"speaker"`
+	Start   []string                 `json:"start"`
+	Nodes   map[string]*DialogueNode `json:"nodes"`
+}
+
+// DialogueSession tracks an open conversation.
+type DialogueSession struct {
+	dialogue *Dialogue
+	npc      *NPC
+	node     *DialogueNode
+	choices  []DialogueChoice // choices visible at the current node
+	selected int
+}
+
+func loadDialogues(fsys fs.FS, dir string) map[string]*Dialogue {
+	dialogues := make(map[string]*Dialogue)
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		log.Printf("Warning: Failed to read dialogue dir %s: %v", dir, err)
+		return dialogues
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			log.Printf("Warning: Failed to load dialogue %s: %v", entry.Name(), err)
+			continue
+		}
+
+		var d Dialogue
+		if err := json.Unmarshal(data, &d); err != nil {
+			log.Printf("Warning: Failed to parse dialogue %s: %v", entry.Name(), err)
+			continue
+		}
+		if d.ID == "" {
+			d.ID = strings.TrimSuffix(entry.Name(), ".json")
+		}
+		if !d.hasFallbackStart() {
+			log.Printf("Warning: Dialogue %s has no start node without a condition, the NPC can't always be talked to", entry.Name())
+		}
+
+		dialogues[d.ID] = &d
+	}
+
+	return dialogues
+}
+
+func (g *Game) checkDialogueCondition(c *DialogueCondition) bool {
+	if c == nil {
+		return true
+	}
+	if c.MinFish != nil && g.itemsCollected < *c.MinFish {
+		return false
+	}
+	if c.MaxFish != nil && g.itemsCollected > *c.MaxFish {
+		return false
+	}
+	if c.Level != 0 && g.currentLevel != c.Level {
+		return false
+	}
+	if c.Flag != "" && !g.dialogueFlags[c.Flag] {
+		return false
+	}
+	if c.NotFlag != "" && g.dialogueFlags[c.NotFlag] {
+		return false
+	}
+	if c.QuestActive != "" && !g.quests.IsActive(c.QuestActive) {
+		return false
+	}
+	if c.QuestDone != "" && !g.quests.IsCompleted(c.QuestDone) {
+		return false
+	}
+	return true
+}
+
+func (g *Game) applyEffect(e *Effect) {
+	if e == nil {
+		return
+	}
+
+	if e.GiveFish > 0 {
+		g.giveFish(e.FishSpecies, e.GiveFish)
+	}
+	if e.UnlockPortal {
+		g.unlockPortal()
+	}
+	if e.GiveLife > 0 {
+		g.lives += e.GiveLife
+	}
+	if e.SetFlag != "" {
+		g.dialogueFlags[e.SetFlag] = true
+	}
+	if e.GiveQuest != "" {
+		g.quests.Assign(e.GiveQuest)
+	}
+	if e.Status != "" {
+		g.player.AddStatus(e.Status, e.StatusSeconds)
+	}
+}
+
+// giveFish hands the cat fish as if it had eaten them, so they count for the
+// score, quests and achievements too
+func (g *Game) giveFish(name string, n int) {
+	species := g.itemRegistry.Get(name)
+	if species == nil {
+		if name != "" {
+			log.Printf("Warning: can't give unknown fish species %q", name)
+		}
+		good := g.itemRegistry.Good()
+		if len(good) == 0 {
+			return
+		}
+		species = good[0]
+	}
+	for range n {
+		item := &Item{itemType: species.ItemType(), species: species, collected: true}
+		Publish(g.events, ItemCollected{Item: item})
+	}
+}
+
+// nearestTalkableNPC returns the closest NPC with a dialogue within talking
+// distance of the player, or nil.
+func (g *Game) nearestTalkableNPC() *NPC {
+	px, py, pw, ph := g.player.GetBounds()
+	cx := px + pw/2
+	cy := py + ph/2
+
+	var nearest *NPC
+	best := talkDistance * talkDistance
+	for _, npc := range g.npcs {
+		if npc.dialogueID == "" || g.dialogueStart(g.dialogues[npc.dialogueID]) == nil {
+			continue
+		}
+		nx, ny := npc.Center()
+		dist := (nx-cx)*(nx-cx) + (ny-cy)*(ny-cy)
+		if dist <= best {
+			best = dist
+			nearest = npc
+		}
+	}
+
+	return nearest
+}
+
+func (g *Game) startDialogue(npc *NPC) {
+	d := g.dialogues[npc.dialogueID]
+	if d == nil {
+		return
+	}
+
+	// Hand over any fish the NPC is waiting for before they start talking
+	g.quests.OnTalk(g, npc.dialogueID)
+
+	if node := g.dialogueStart(d); node != nil {
+		g.dialogue = &DialogueSession{dialogue: d, npc: npc}
+		g.showDialogueNode(node)
+		g.state = StateDialogue
+	}
+}
+
+// dialogueStart is the first start node whose condition passes, or nil if
+// none does (or there's no dialogue)
+func (g *Game) dialogueStart(d *Dialogue) *DialogueNode {
+	if d == nil {
+		return nil
+	}
+	for _, id := range d.Start {
+		if node := d.Nodes[id]; node != nil && g.checkDialogueCondition(node.If) {
+			return node
+		}
+	}
+	return nil
+}
+
+// hasFallbackStart is true if one of the start nodes has no condition, so
+// talking always opens the dialogue
+func (d *Dialogue) hasFallbackStart() bool {
+	for _, id := range d.Start {
+		if node := d.Nodes[id]; node != nil && node.If == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) showDialogueNode(node *DialogueNode) {
+	s := g.dialogue
+	s.node = node
+	s.selected = 0
+	s.choices = s.choices[:0]
+	for _, c := range node.Choices {
+		if g.checkDialogueCondition(c.If) {
+			s.choices = append(s.choices, c)
+		}
+	}
+}
+
+func (g *Game) endDialogue() {
+	g.dialogue = nil
+	g.state = StatePlaying
+}
+
+func (g *Game) updateDialogue() {
+	s := g.dialogue
+	if s == nil {
+		g.state = StatePlaying
+		return
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.endDialogue()
+		return
+	}
+
+	// A node without choices is just a line of text; any confirm closes it.
+	if len(s.choices) == 0 {
+		if inpututil.IsKeyJustPressed(ebiten.KeyE) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+			g.endDialogue()
+		}
+		return
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) || inpututil.IsKeyJustPressed(ebiten.KeyW) {
+		s.selected = (s.selected + len(s.choices) - 1) % len(s.choices)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) || inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		s.selected = (s.selected + 1) % len(s.choices)
+	}
+
+	picked := -1
+	for i := 0; i < len(s.choices) && i < 9; i++ {
+		if inpututil.IsKeyJustPressed(ebiten.Key1 + ebiten.Key(i)) {
+			picked = i
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyE) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		picked = s.selected
+	}
+	if picked < 0 {
+		return
+	}
+
+	choice := s.choices[picked]
+	g.applyEffect(choice.Effect)
+
+	next := s.dialogue.Nodes[choice.Next]
+	if choice.Next == "" || next == nil {
+		g.endDialogue()
+		return
+	}
+	g.showDialogueNode(next)
+}
+
+func (g *Game) drawDialogue(screen *ebiten.Image) {
+	s := g.dialogue
+	if s == nil {
+		return
+	}
+
+	boxY := screenHeight - dialogueBoxH - 10
+	box := ebiten.NewImage(screenWidth-20, dialogueBoxH)
+	box.Fill(color.RGBA{20, 20, 40, 230})
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(10, float64(boxY))
+	screen.DrawImage(box, op)
+
+	textX := 30
+	if s.npc.portrait != nil {
+		pop := &ebiten.DrawImageOptions{}
+		pw := float64(s.npc.portrait.Bounds().Dx())
+		scale := 128.0 / pw
+		pop.GeoM.Scale(scale, scale)
+		pop.GeoM.Translate(25, float64(boxY+20))
+		screen.DrawImage(s.npc.portrait, pop)
+		textX = 170
+	}
+
+	text.Draw(screen, s.dialogue.Speaker, basicfont.Face7x13, textX, boxY+22, color.RGBA{255, 215, 0, 255})
+
+	lineY := boxY + 42
+	for _, line := range wrapText(s.node.Text, dialogueWrapW-(textX/7)) {
+		text.Draw(screen, line, basicfont.Face7x13, textX, lineY, color.White)
+		lineY += 15
+	}
+
+	lineY += 8
+	if len(s.choices) == 0 {
+		text.Draw(screen, "[E] Continue", basicfont.Face7x13, textX, lineY, color.RGBA{200, 200, 200, 255})
+		return
+	}
+	for i, c := range s.choices {
+		clr := color.Color(color.RGBA{200, 200, 200, 255})
+		prefix := "  "
+		if i == s.selected {
+			clr = color.RGBA{255, 215, 0, 255}
+			prefix = "> "
+		}
+		text.Draw(screen, fmt.Sprintf("%s%d. %s", prefix, i+1, c.Text), basicfont.Face7x13, textX, lineY, clr)
+		lineY += 15
+	}
+}
+
+// drawTalkPrompt shows a hint above the NPC the player can talk to.
+func (g *Game) drawTalkPrompt(screen *ebiten.Image) {
+	npc := g.nearestTalkableNPC()
+	if npc == nil {
+		return
+	}
+
+	sx, sy := g.camera.WorldToScreen(npc.x, npc.y)
+	text.Draw(screen, "[E] Talk", basicfont.Face7x13, int(sx), int(sy)-6, color.RGBA{255, 255, 255, 255})
+}
+
+func wrapText(s string, width int) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
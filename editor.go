@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	editorPanSpeed  = 8.0
+	editorSwatch    = 40 // palette tile size on screen
+	editorPickRange = 48.0
+)
+
+type EditorTool int
+
+const (
+	ToolTiles EditorTool = iota
+	ToolNPC
+	ToolCar
+	ToolItem
+	ToolPortal
+	ToolStart
+)
+
+var editorToolNames = []string{"Tiles", "NPC", "Car", "Item", "Portal", "Player start"}
+
+// Editor is the in-game level editor (F2). It paints tiles on the first
+// layer and edits the level's objects; the world doesn't move while editing.
+type Editor struct {
+	tool       EditorTool
+	camX, camY float64
+	palette    []uint32
+	tile       int // index into palette
+
+	// Settings for the next object placed
+	dialogue  int // index into dialogueIDs, 0 is none
+	npcRange  float64
+	npcHorz   bool
+	npcStatic bool
+	carSprite int // index into carSpriteNames
+	carSpeed  float64
+	species   int // index into the item registry
+}
+
+func NewEditor() *Editor {
+	return &Editor{npcRange: 100, npcHorz: true, carSpeed: 2}
+}
+
+func (g *Game) startEditor() {
+	if g.editor == nil {
+		g.editor = NewEditor()
+	}
+	e := g.editor
+	e.palette = g.tileMap.Palette()
+	if e.tile >= len(e.palette) {
+		e.tile = 0
+	}
+	e.camX = g.player.x + float64(g.player.width)/2
+	e.camY = g.player.y + float64(g.player.height)/2
+	g.state = StateEditor
+	g.disqualifyRun()
+	g.spawnLevel()
+}
+
+// stopEditor plays the edited level from the start
+func (g *Game) stopEditor() {
+	g.state = StatePlaying
+	g.itemsCollected = 0
+	g.fishBySpecies = make(map[string]int)
+	g.startLevelScore(g.currentLevel)
+	g.quests.RestartObjective()
+	g.spawnLevel()
+}
+
+func (g *Game) updateEditor() {
+	e := g.editor
+	ctrl := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
+		g.stopEditor()
+		return
+	}
+	if ctrl && inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		file, err := g.saveLevel("")
+		if err != nil {
+			g.showToast("Save failed: " + err.Error())
+		} else {
+			g.showToast("Saved " + file)
+		}
+		return
+	}
+
+	// Pan
+	if !ctrl {
+		if ebiten.IsKeyPressed(ebiten.KeyLeft) || ebiten.IsKeyPressed(ebiten.KeyA) {
+			e.camX -= editorPanSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyRight) || ebiten.IsKeyPressed(ebiten.KeyD) {
+			e.camX += editorPanSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyUp) || ebiten.IsKeyPressed(ebiten.KeyW) {
+			e.camY -= editorPanSpeed
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyDown) || ebiten.IsKeyPressed(ebiten.KeyS) {
+			e.camY += editorPanSpeed
+		}
+	}
+	e.camX = math.Max(0, math.Min(e.camX, float64(g.tileMap.Width())))
+	e.camY = math.Max(0, math.Min(e.camY, float64(g.tileMap.Height())))
+	g.camera.Follow.W = int(e.camX)
+	g.camera.Follow.H = int(e.camY)
+
+	for i := range editorToolNames {
+		if inpututil.IsKeyJustPressed(ebiten.Key1 + ebiten.Key(i)) {
+			e.tool = EditorTool(i)
+		}
+	}
+
+	// Tool settings
+	step := 0
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketRight) {
+		step = 1
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft) {
+		step = -1
+	}
+	_, wheel := ebiten.Wheel()
+	if wheel > 0 {
+		step = -1
+	} else if wheel < 0 {
+		step = 1
+	}
+	if step != 0 {
+		switch e.tool {
+		case ToolTiles:
+			e.tile = wrapIndex(e.tile+step, len(e.palette))
+		case ToolNPC:
+			e.dialogue = wrapIndex(e.dialogue+step, len(g.dialogueIDs()))
+		case ToolCar:
+			e.carSprite = wrapIndex(e.carSprite+step, len(carSpriteNames()))
+		case ToolItem:
+			e.species = wrapIndex(e.species+step, len(g.itemRegistry.Species))
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEqual) || inpututil.IsKeyJustPressed(ebiten.KeyMinus) {
+		delta := 1.0
+		if inpututil.IsKeyJustPressed(ebiten.KeyMinus) {
+			delta = -1
+		}
+		if e.tool == ToolNPC {
+			e.npcRange = math.Max(0, e.npcRange+delta*10)
+		} else if e.tool == ToolCar {
+			e.carSpeed = math.Max(0.5, e.carSpeed+delta*0.5)
+		}
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+		e.npcHorz = !e.npcHorz
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		e.npcStatic = !e.npcStatic
+	}
+
+	mx, my := ebiten.CursorPosition()
+	wx, wy := g.cursorWorld()
+
+	if e.tool == ToolTiles {
+		if i, ok := e.paletteAt(mx, my); ok {
+			if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+				e.tile = i
+			}
+			return
+		}
+		tw, th := g.tileMap.TileSize()
+		tx, ty := int(wx)/tw, int(wy)/th
+		if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) && len(e.palette) > 0 {
+			g.tileMap.SetTile(0, tx, ty, e.palette[e.tile])
+		}
+		if ebiten.IsMouseButtonPressed(ebiten.MouseButtonRight) {
+			g.tileMap.SetTile(0, tx, ty, 0)
+		}
+		return
+	}
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		if i := g.objectNear(wx, wy); i >= 0 {
+			g.levelObjects = append(g.levelObjects[:i], g.levelObjects[i+1:]...)
+			g.spawnLevel()
+		}
+		return
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		g.placeObject(e.newObject(g, wx-32, wy-32))
+		g.spawnLevel()
+	}
+}
+
+// newObject makes a level object for the current tool and settings
+func (e *Editor) newObject(g *Game, x, y float64) MapObject {
+	x, y = math.Round(x), math.Round(y)
+	obj := MapObject{X: x, Y: y, Props: make(map[string]string)}
+
+	switch e.tool {
+	case ToolNPC:
+		obj.Kind = "npc"
+		obj.Props["range"] = strconv.FormatFloat(e.npcRange, 'f', -1, 64)
+		obj.Props["horizontal"] = strconv.FormatBool(e.npcHorz)
+		if e.npcStatic {
+			obj.Props["static"] = "true"
+		}
+		if id := g.dialogueIDs()[e.dialogue]; id != "" {
+			obj.Props["dialogue"] = id
+		}
+	case ToolCar:
+		obj.Kind = "car"
+		obj.Props["sprite"] = carSpriteNames()[e.carSprite]
+		obj.Props["speed"] = strconv.FormatFloat(e.carSpeed, 'f', -1, 64)
+	case ToolItem:
+		obj.Kind = "item"
+		obj.Props["species"] = g.itemRegistry.Species[e.species].Name
+	case ToolPortal:
+		obj.Kind = "portal"
+	case ToolStart:
+		obj.Kind = "player"
+	}
+	return obj
+}
+
+// placeObject adds an object; there's only one portal and player start
+func (g *Game) placeObject(obj MapObject) {
+	if obj.Kind == "portal" || obj.Kind == "player" {
+		for i, o := range g.levelObjects {
+			if o.Kind == obj.Kind {
+				g.levelObjects[i] = obj
+				return
+			}
+		}
+	}
+	g.levelObjects = append(g.levelObjects, obj)
+}
+
+// objectNear returns the index of the object closest to a map position, or
+// -1 if none is in reach
+func (g *Game) objectNear(x, y float64) int {
+	best := -1
+	bestDist := editorPickRange
+	for i, obj := range g.levelObjects {
+		d := math.Hypot(obj.X+32-x, obj.Y+32-y)
+		if d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// dialogueIDs lists the dialogues an NPC can have, "" (none) first
+func (g *Game) dialogueIDs() []string {
+	ids := []string{""}
+	for id := range g.dialogues {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids[1:])
+	return ids
+}
+
+func carSpriteNames() []string {
+	var names []string
+	for name := range carSprites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func wrapIndex(i, n int) int {
+	if n == 0 {
+		return 0
+	}
+	return ((i % n) + n) % n
+}
+
+// paletteAt returns the palette entry under a screen position
+func (e *Editor) paletteAt(x, y int) (int, bool) {
+	top := screenHeight - editorSwatch - 8
+	if y < top || y >= top+editorSwatch || x < 4 {
+		return 0, false
+	}
+	first, _ := e.paletteWindow()
+	i := first + (x-4)/(editorSwatch+4)
+	if i >= len(e.palette) {
+		return 0, false
+	}
+	return i, true
+}
+
+// paletteWindow is the range of palette entries that fit on screen, kept
+// around the selected tile
+func (e *Editor) paletteWindow() (int, int) {
+	fits := (screenWidth - 8) / (editorSwatch + 4)
+	first := 0
+	if e.tile >= fits {
+		first = e.tile - fits + 1
+	}
+	last := first + fits
+	if last > len(e.palette) {
+		last = len(e.palette)
+	}
+	return first, last
+}
+
+func (g *Game) drawEditor(screen *ebiten.Image) {
+	e := g.editor
+	g.drawWorld(screen)
+	g.drawDebugWorld(screen)
+
+	// Start marker
+	sx, sy := g.camera.WorldToScreen(g.player.x, g.player.y)
+	text.Draw(screen, "START", basicfont.Face7x13, int(sx)+14, int(sy)-4, debugPlayerColor)
+
+	wx, wy := g.cursorWorld()
+	mx, my := ebiten.CursorPosition()
+	if e.tool == ToolTiles {
+		tw, th := g.tileMap.TileSize()
+		tx, ty := float64(int(wx)/tw*tw), float64(int(wy)/th*th)
+		hx, hy := g.camera.WorldToScreen(tx, ty)
+		debugRect(screen, hx, hy, float64(tw), float64(th), color.RGBA{255, 255, 0, 255})
+	} else {
+		debugRect(screen, float64(mx-32), float64(my-32), 64, 64, color.RGBA{255, 255, 0, 255})
+	}
+
+	// Tool bar
+	vector.FillRect(screen, 0, 0, screenWidth, 52, color.RGBA{0, 0, 0, 190}, false)
+	var tools []string
+	for i, name := range editorToolNames {
+		label := fmt.Sprintf("%d %s", i+1, name)
+		if EditorTool(i) == e.tool {
+			label = "[" + label + "]"
+		}
+		tools = append(tools, label)
+	}
+	text.Draw(screen, "EDITOR  "+strings.Join(tools, "  "), basicfont.Face7x13, 10, 18, color.RGBA{255, 255, 100, 255})
+	text.Draw(screen, e.settingsText(g), basicfont.Face7x13, 10, 36, color.White)
+	text.Draw(screen, "WASD pan  LMB place/paint  RMB delete/erase  [ ] cycle  Ctrl+S save  F2 play", basicfont.Face7x13, 10, 50, color.RGBA{180, 180, 180, 255})
+
+	if e.tool == ToolTiles {
+		e.drawPalette(g, screen)
+	}
+}
+
+func (e *Editor) settingsText(g *Game) string {
+	switch e.tool {
+	case ToolTiles:
+		if len(e.palette) == 0 {
+			return "No tiles"
+		}
+		return fmt.Sprintf("Tile GID %d (%d/%d)", e.palette[e.tile], e.tile+1, len(e.palette))
+	case ToolNPC:
+		dialogue := g.dialogueIDs()[e.dialogue]
+		if dialogue == "" {
+			dialogue = "none"
+		}
+		dir := "vertical"
+		if e.npcHorz {
+			dir = "horizontal"
+		}
+		kind := "walking"
+		if e.npcStatic {
+			kind = "static"
+		}
+		return fmt.Sprintf("Dialogue: %s  Range: %.0f (+/-)  %s (H)  %s (T)", dialogue, e.npcRange, dir, kind)
+	case ToolCar:
+		return fmt.Sprintf("Sprite: %s  Speed: %.1f (+/-)", carSpriteNames()[e.carSprite], e.carSpeed)
+	case ToolItem:
+		if len(g.itemRegistry.Species) == 0 {
+			return "No species"
+		}
+		return "Species: " + g.itemRegistry.Species[e.species].Name
+	}
+	return "Click to move"
+}
+
+func (e *Editor) drawPalette(g *Game, screen *ebiten.Image) {
+	top := float32(screenHeight - editorSwatch - 8)
+	vector.FillRect(screen, 0, top-4, screenWidth, editorSwatch+12, color.RGBA{0, 0, 0, 190}, false)
+
+	first, last := e.paletteWindow()
+	for i := first; i < last; i++ {
+		img := g.tileMap.TileImage(e.palette[i])
+		x := float64(4 + (i-first)*(editorSwatch+4))
+		op := &ebiten.DrawImageOptions{}
+		b := img.Bounds()
+		op.GeoM.Scale(editorSwatch/float64(b.Dx()), editorSwatch/float64(b.Dy()))
+		op.GeoM.Translate(x, float64(top))
+		screen.DrawImage(img, op)
+		if i == e.tile {
+			debugRect(screen, x-1, float64(top)-1, editorSwatch+2, editorSwatch+2, color.RGBA{255, 255, 0, 255})
+		}
+	}
+}
+
+// saveLevel writes the current map and objects as TMX. With no file it
+// saves over the map file being played from disk, into -assets-dir, or to
+// levelN.tmx.
+func (g *Game) saveLevel(file string) (string, error) {
+	// Where the tileset images are on disk
+	imageDir := filepath.Dir(g.levelPath)
+	fromDisk := g.mapFile != "" && g.levelPath == g.mapFile
+	if !fromDisk {
+		root := g.assets.devDir
+		if root == "" {
+			root = "."
+		}
+		imageDir = filepath.Join(root, filepath.FromSlash(path.Dir(g.levelPath)))
+	}
+
+	if file == "" {
+		switch {
+		case fromDisk:
+			file = g.levelPath
+		case g.assets.devDir != "":
+			file = filepath.Join(g.assets.devDir, filepath.FromSlash(g.levelPath))
+		default:
+			file = fmt.Sprintf("level%d.tmx", g.currentLevel)
+		}
+	}
+
+	// Keep image paths relative to the new file
+	saveDir, _ := filepath.Abs(filepath.Dir(file))
+	imageDir, _ = filepath.Abs(imageDir)
+	source := func(src string) string {
+		rel, err := filepath.Rel(saveDir, filepath.Join(imageDir, filepath.FromSlash(src)))
+		if err != nil {
+			return src
+		}
+		return filepath.ToSlash(rel)
+	}
+
+	m, err := g.tileMap.TMX(g.levelObjects, source)
+	if err != nil {
+		return "", err
+	}
+	data, err := m.Encode()
+	if err != nil {
+		return "", err
+	}
+	return file, os.WriteFile(file, data, 0o644)
+}
+
+// registerEditorCommands adds the editor's console commands
+func (g *Game) registerEditorCommands() {
+	g.console.Register(&Command{Name: "savemap", Usage: "[file.tmx]", Help: "save the current map and its objects as TMX",
+		Run: func(g *Game, args []string) error {
+			file, err := g.saveLevel(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			g.console.Print("Saved %s", file)
+			return nil
+		}})
+}
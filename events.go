@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Gameplay events. The collision checks publish these and everything that
+// reacts to them (rules, sound, HUD, score, quests, achievements, stats)
+// subscribes in Game.subscribe, so a new reaction doesn't mean touching the
+// collision code.
+
+// ItemCollected is any item the cat ate or swiped, fish, power-up or hazard,
+// or fish it was given
+type ItemCollected struct {
+	Item *Item
+}
+
+// PlayerHit is the cat touching a hazard or a car while it can be hurt.
+// One of Item and Car is set.
+type PlayerHit struct {
+	Item *Item
+	Car  *Car
+}
+
+// LifeLost follows a PlayerHit once the life is gone
+type LifeLost struct {
+	ByCar     bool
+	LivesLeft int
+}
+
+// PortalUnlocked is the first time the portal opens on a level
+type PortalUnlocked struct {
+	Level int
+}
+
+// LevelCompleted is the cat going through the portal, with the level's
+// finished score
+type LevelCompleted struct {
+	Score LevelScore
+	Final bool // the last level, the game is won
+}
+
+// CarNearMiss is a car passing close by without hitting the cat
+type CarNearMiss struct {
+	Car *Car
+}
+
+// EventBus passes events to the handlers subscribed to their type, in the
+// order they subscribed. Handlers run straight away, inside Publish.
+type EventBus struct {
+	handlers map[reflect.Type][]any // func(E) for each event type E
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{handlers: make(map[reflect.Type][]any)}
+}
+
+// Subscribe calls handler for every event of type E
+func Subscribe[E any](bus *EventBus, handler func(E)) {
+	t := reflect.TypeFor[E]()
+	bus.handlers[t] = append(bus.handlers[t], handler)
+}
+
+func Publish[E any](bus *EventBus, event E) {
+	for _, handler := range bus.handlers[reflect.TypeFor[E]()] {
+		handler.(func(E))(event)
+	}
+}
+
+// subscribe sets up how the game reacts to gameplay events. Order matters
+// where one reaction reads what another changes: fish are counted before
+// the achievements look at them, and the score is final before the run is
+// offered a high score. There are no particles yet; they'd subscribe here
+// too.
+func (g *Game) subscribe() {
+	bus := g.events
+
+	// Rules
+	Subscribe(bus, func(e ItemCollected) {
+		if e.Item.itemType == ItemGood {
+			g.itemsCollected++
+			g.fishBySpecies[e.Item.SpeciesName()]++
+		}
+		g.applyEffect(e.Item.species.Effect)
+	})
+
+	// Sound
+	Subscribe(bus, func(e ItemCollected) {
+		g.audioManager.Play("eat")
+	})
+	Subscribe(bus, func(e PlayerHit) {
+		if e.Car != nil {
+			g.audioManager.Play("honk")
+		} else {
+			g.audioManager.Play("ouch")
+		}
+	})
+	Subscribe(bus, func(e LifeLost) {
+		g.audioManager.music.Stinger("lifelost")
+	})
+	Subscribe(bus, func(e PortalUnlocked) {
+		g.audioManager.music.Stinger("unlock")
+	})
+	Subscribe(bus, func(e LevelCompleted) {
+		if e.Final {
+			g.audioManager.music.Stinger("victory")
+		}
+	})
+
+	// HUD
+	Subscribe(bus, func(e PortalUnlocked) {
+		g.showToast("The portal is open!")
+	})
+
+	// Score, records and quests
+	Subscribe(bus, func(e ItemCollected) {
+		if e.Item.itemType == ItemGood {
+			g.scoreFish(e.Item.species)
+			g.quests.OnItemCollected(g, e.Item.SpeciesName())
+		}
+	})
+	Subscribe(bus, func(e PlayerHit) {
+		if e.Car != nil {
+			g.quests.OnPlayerHit()
+		}
+	})
+	Subscribe(bus, func(e LifeLost) {
+		g.scoreLifeLost()
+	})
+	Subscribe(bus, func(e LevelCompleted) {
+		g.recordLevelBest(e.Score)
+		if e.Final {
+			g.finishRun()
+		}
+	})
+
+	// Achievements
+	Subscribe(bus, func(e ItemCollected) {
+		if e.Item.itemType != ItemGood {
+			return
+		}
+		name := e.Item.SpeciesName()
+		g.achieve(Trigger{Kind: TriggerFish, Species: name, Level: g.currentLevel})
+		if g.fishBySpecies[name] == 1 && len(g.fishBySpecies) == len(g.itemRegistry.Good()) {
+			g.achieve(Trigger{Kind: TriggerAllSpecies, Level: g.currentLevel})
+		}
+	})
+	Subscribe(bus, func(e CarNearMiss) {
+		g.achieve(Trigger{Kind: TriggerNearMiss, Level: g.currentLevel})
+	})
+	Subscribe(bus, func(e LevelCompleted) {
+		g.achieve(Trigger{Kind: TriggerLevelComplete, Level: e.Score.Level})
+		if e.Score.LivesLost == 0 {
+			g.achieve(Trigger{Kind: TriggerFlawless, Level: e.Score.Level})
+		}
+		g.achievements.Flush()
+	})
+	Subscribe(bus, func(e LifeLost) {
+		if e.LivesLeft <= 0 {
+			g.achievements.Flush()
+		}
+	})
+
+	// Stats
+	Subscribe(bus, func(e ItemCollected) {
+		g.stats.Items[e.Item.SpeciesName()]++
+	})
+	Subscribe(bus, func(e PlayerHit) {
+		g.stats.Hits++
+	})
+	Subscribe(bus, func(e LifeLost) {
+		g.stats.LivesLost++
+	})
+	Subscribe(bus, func(e CarNearMiss) {
+		g.stats.NearMisses++
+	})
+	Subscribe(bus, func(e LevelCompleted) {
+		g.stats.Levels++
+	})
+
+	// Losing the life and changing screens go last, once everything else has
+	// seen the event
+	Subscribe(bus, func(e PlayerHit) {
+		if e.Car != nil {
+			e.Car.nearby = false
+		}
+		g.lives--
+		g.player.Hurt()
+		Publish(bus, LifeLost{ByCar: e.Car != nil, LivesLeft: g.lives})
+	})
+	Subscribe(bus, func(e LifeLost) {
+		if e.LivesLeft > 0 {
+			g.state = StateLifeLost
+			g.lifeLostTimer = 90
+			return
+		}
+		if e.ByCar {
+			g.state = StateCarDeath
+		} else {
+			g.state = StateGameOver
+		}
+		g.endRun()
+	})
+	Subscribe(bus, func(e LevelCompleted) {
+		if e.Final {
+			// Beat the FINAL LEVEL!
+			g.state = StateGameWon
+			g.endRun()
+		} else {
+			g.state = StateLevelResults
+		}
+	})
+}
+
+// SessionStats counts what happened since the game was started, for the
+// console's stats command
+type SessionStats struct {
+	Items      map[string]int // by species
+	Hits       int
+	LivesLost  int
+	NearMisses int
+	Levels     int
+}
+
+func NewSessionStats() *SessionStats {
+	return &SessionStats{Items: make(map[string]int)}
+}
+
+// Lines describes the stats for the console, species sorted by name
+func (s *SessionStats) Lines() []string {
+	lines := []string{fmt.Sprintf("levels %d  hits %d  lives lost %d  near misses %d", s.Levels, s.Hits, s.LivesLost, s.NearMisses)}
+	names := make([]string, 0, len(s.Items))
+	for name := range s.Items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s: %d", name, s.Items[name]))
+	}
+	return lines
+}
@@ -1,25 +1,39 @@
 package main
 
 import (
+	"math"
+
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
+const (
+	fleeDistance = 150.0
+	fleeSpeed    = 1.6
+)
+
 type ItemType int
 
 const (
 	ItemGood ItemType = iota
 	ItemBad
 	ItemPortal
+	ItemPowerUp
 )
 
 type Item struct {
-	x, y           float64
-	width          int
-	height         int
-	itemType       ItemType
-	image          *ebiten.Image
-	animatedSprite *AnimatedSprite
-	collected      bool
+	x, y       float64
+	width      int
+	height     int
+	itemType   ItemType
+	image      *ebiten.Image
+	anim       *AnimStateMachine // animated items like the portal
+	collected  bool
+	species    *ItemSpecies // nil for the portal
+	lifeTicks  int          // ticks left before despawning, 0 = forever
+	flopTimer  int
+	hop        float64 // vertical draw offset while flopping
+	vx, vy     float64 // sliding after being knocked by a pounce
+	knockTimer int     // can't hurt the cat while this counts down
 }
 
 func NewItem(x, y float64, itemType ItemType, image *ebiten.Image) *Item {
@@ -32,18 +46,87 @@ func NewItem(x, y float64, itemType ItemType, image *ebiten.Image) *Item {
 		image:    image,
 	}
 
-	if itemType == ItemPortal {
-		item.animatedSprite = NewAnimatedSprite(image, 32, 32)
-		item.animatedSprite.frameCount = 6
-	}
+	return item
+}
 
+// NewPortal needs an atlas with a "spin" clip
+func NewPortal(x, y float64, atlas *Atlas) *Item {
+	item := NewItem(x, y, ItemPortal, atlas.Image)
+	item.anim = NewAnimStateMachine()
+	item.anim.AddState("spin", atlas.MustClip("spin"))
 	return item
 }
 
-func (i *Item) Update() {
-	if i.animatedSprite != nil {
-		i.animatedSprite.Update()
+// NewSpeciesItem creates a pickup from the item registry
+func NewSpeciesItem(x, y float64, species *ItemSpecies) *Item {
+	item := NewItem(x, y, species.ItemType(), species.image)
+	item.species = species
+	item.lifeTicks = int(species.Lifetime * ebiten.DefaultTPS)
+	item.flopTimer = rng.Intn(90)
+	return item
+}
+
+// SpeciesName returns the species name, or "" for items without one
+func (i *Item) SpeciesName() string {
+	if i.species == nil {
+		return ""
 	}
+	return i.species.Name
+}
+
+// Update animates the item and runs its species behavior. playerX/playerY is
+// the center of the cat.
+func (i *Item) Update(playerX, playerY float64, mapWidth, mapHeight int) {
+	if i.anim != nil {
+		i.anim.Update()
+	}
+	if i.collected || i.species == nil {
+		return
+	}
+
+	if i.knockTimer > 0 {
+		i.knockTimer--
+		i.x += i.vx
+		i.y += i.vy
+		i.vx *= 0.9
+		i.vy *= 0.9
+	}
+
+	if i.lifeTicks > 0 {
+		i.lifeTicks--
+		if i.lifeTicks == 0 {
+			i.collected = true // gone, without counting as a pickup
+			return
+		}
+	}
+
+	switch i.species.Behavior {
+	case BehaviorFlop:
+		i.flopTimer++
+		if i.flopTimer >= 90 {
+			i.flopTimer = 0
+			i.x += float64(rng.Intn(41) - 20)
+			i.y += float64(rng.Intn(41) - 20)
+		}
+		// Little hop for the first half second after each flop
+		if i.flopTimer < 30 {
+			i.hop = -math.Sin(float64(i.flopTimer)/30*math.Pi) * 10
+		} else {
+			i.hop = 0
+		}
+	case BehaviorFlee:
+		cx := i.x + float64(i.width)/2
+		cy := i.y + float64(i.height)/2
+		dx, dy := cx-playerX, cy-playerY
+		dist := math.Hypot(dx, dy)
+		if dist > 0 && dist < fleeDistance {
+			i.x += dx / dist * fleeSpeed
+			i.y += dy / dist * fleeSpeed
+		}
+	}
+
+	i.x = math.Max(0, math.Min(i.x, float64(mapWidth-i.width)))
+	i.y = math.Max(0, math.Min(i.y, float64(mapHeight-i.height)))
 }
 
 func (i *Item) Draw(screen *ebiten.Image, cameraX, cameraY float64) {
@@ -55,20 +138,35 @@ func (i *Item) DrawWithAlpha(screen *ebiten.Image, cameraX, cameraY, alpha float
 		return
 	}
 
+	// Blink for the last few seconds before despawning
+	if i.lifeTicks > 0 && i.lifeTicks < 3*ebiten.DefaultTPS && (i.lifeTicks/8)%2 == 0 {
+		return
+	}
+
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(2.0, 2.0)
-	op.GeoM.Translate(i.x-cameraX, i.y-cameraY)
+	op.GeoM.Translate(i.x-cameraX, i.y+i.hop-cameraY)
+	if i.species != nil && len(i.species.Tint) == 3 {
+		op.ColorScale.Scale(i.species.Tint[0], i.species.Tint[1], i.species.Tint[2], 1)
+	}
 	op.ColorScale.ScaleAlpha(float32(alpha))
 
-	if i.animatedSprite != nil {
-		i.animatedSprite.Draw(screen, op)
+	if i.anim != nil {
+		i.anim.Draw(screen, op, 0)
 	} else {
 		screen.DrawImage(i.image, op)
 	}
 }
 
+// Knock sends the item sliding away in the given direction
+func (i *Item) Knock(dx, dy float64) {
+	i.vx = dx * 9
+	i.vy = dy * 9
+	i.knockTimer = 40
+}
+
 func (i *Item) CheckCollision(px, py, pw, ph float64) bool {
-	if i.collected {
+	if i.collected || i.knockTimer > 0 {
 		return false
 	}
 
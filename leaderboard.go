@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	leaderboardVersion = 1
+	maxHighScores      = 10
+	maxNameLength      = 12
+)
+
+type HighScore struct {
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+	Level int    `json:"level"` // level the run got to
+	Date  string `json:"date"`
+}
+
+// LevelBest is the best finish of one level. The time and the lives can
+// come from different runs.
+type LevelBest struct {
+	Ticks     int `json:"ticks"`
+	LivesLost int `json:"livesLost"`
+}
+
+// Leaderboard is the local high score table, kept in leaderboard.json next
+// to the save file
+type Leaderboard struct {
+	Version  int               `json:"version"`
+	LastName string            `json:"lastName,omitempty"` // offered for the next name entry
+	Scores   []HighScore       `json:"scores"`             // best first
+	Levels   map[int]LevelBest `json:"levels"`             // by level number
+
+	readOnly bool // the file couldn't be read or is from a newer game, leave it alone
+}
+
+func leaderboardPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "leaderboard.json"), nil
+}
+
+// loadLeaderboard reads the leaderboard file. One that can't be parsed is
+// moved aside to leaderboard.json.bad and a new one started; entries that
+// don't make sense are dropped.
+func loadLeaderboard() *Leaderboard {
+	lb := &Leaderboard{Version: leaderboardVersion, Levels: make(map[int]LevelBest)}
+	path, err := leaderboardPath()
+	if err != nil {
+		lb.readOnly = true
+		return lb
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lb
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to read leaderboard: %v", err)
+		lb.readOnly = true
+		return lb
+	}
+
+	var file Leaderboard
+	if err := json.Unmarshal(raw, &file); err != nil {
+		log.Printf("Warning: Leaderboard %s is damaged (%v), starting a new one", path, err)
+		if err := os.Rename(path, path+".bad"); err != nil {
+			log.Printf("Warning: Failed to move damaged leaderboard aside: %v", err)
+			lb.readOnly = true
+		}
+		return lb
+	}
+	if file.Version > leaderboardVersion {
+		log.Printf("Warning: Leaderboard %s is from a newer version of the game, high scores won't be saved", path)
+		lb.readOnly = true
+		return lb
+	}
+
+	lb.LastName = cleanName(file.LastName)
+	for _, s := range file.Scores {
+		if s.Score <= 0 || s.Level < 1 {
+			continue
+		}
+		if s.Name = cleanName(s.Name); s.Name == "" {
+			s.Name = "???"
+		}
+		lb.Scores = append(lb.Scores, s)
+	}
+	lb.sortScores()
+	for level, best := range file.Levels {
+		if level >= 1 && level < len(levelMaps) && best.Ticks > 0 && best.LivesLost >= 0 {
+			lb.Levels[level] = best
+		}
+	}
+	return lb
+}
+
+// Save writes the leaderboard to a temporary file first, so a crash while
+// saving can't leave half a file behind
+func (lb *Leaderboard) Save() error {
+	if lb.readOnly {
+		return nil
+	}
+	path, err := leaderboardPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(lb, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (lb *Leaderboard) sortScores() {
+	sort.SliceStable(lb.Scores, func(i, j int) bool { return lb.Scores[i].Score > lb.Scores[j].Score })
+	if len(lb.Scores) > maxHighScores {
+		lb.Scores = lb.Scores[:maxHighScores]
+	}
+}
+
+// Qualifies is true if a score would make the table
+func (lb *Leaderboard) Qualifies(score int) bool {
+	return score > 0 && (len(lb.Scores) < maxHighScores || score > lb.Scores[len(lb.Scores)-1].Score)
+}
+
+// Add puts a score on the table and returns its place, or -1 if it didn't
+// make it
+func (lb *Leaderboard) Add(name string, score, level int) int {
+	if !lb.Qualifies(score) {
+		return -1
+	}
+	lb.LastName = name
+	entry := HighScore{Name: name, Score: score, Level: level, Date: time.Now().Format("2006-01-02")}
+	lb.Scores = append(lb.Scores, entry)
+	lb.sortScores()
+	for i := range lb.Scores {
+		if lb.Scores[i] == entry {
+			return i
+		}
+	}
+	return -1
+}
+
+// Raise moves an entry already on the table up to a better score, for a run
+// that carried on after its name was put in. Returns its new place, or -1
+// if the entry has dropped off the table and the new score doesn't make it.
+func (lb *Leaderboard) Raise(entry HighScore, score, level int) int {
+	for i := range lb.Scores {
+		if lb.Scores[i] == entry {
+			lb.Scores = append(lb.Scores[:i], lb.Scores[i+1:]...)
+			break
+		}
+	}
+	return lb.Add(entry.Name, score, level)
+}
+
+// RecordLevel keeps a level's time and lives lost if they beat the best
+func (lb *Leaderboard) RecordLevel(level, ticks, livesLost int) {
+	best, ok := lb.Levels[level]
+	if !ok {
+		lb.Levels[level] = LevelBest{Ticks: ticks, LivesLost: livesLost}
+		return
+	}
+	best.Ticks = min(best.Ticks, ticks)
+	best.LivesLost = min(best.LivesLost, livesLost)
+	lb.Levels[level] = best
+}
+
+// cleanName keeps names short and printable
+func cleanName(name string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range strings.TrimSpace(name) {
+		if n == maxNameLength {
+			break
+		}
+		if unicode.IsPrint(r) && r < unicode.MaxASCII {
+			b.WriteRune(r)
+			n++
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// recordLevelBest adds a finished level to the per-level bests. Maps played
+// from disk aren't the real level and generated levels change with the
+// seed, so they don't count, and neither do cheated runs.
+func (g *Game) recordLevelBest(s LevelScore) {
+	if g.cheated || s.Level >= len(levelMaps) || (g.mapFile != "" && s.Level == g.mapLevel) {
+		return
+	}
+	g.leaderboard.RecordLevel(s.Level, s.Ticks, s.LivesLost)
+	g.storeLeaderboard()
+}
+
+func (g *Game) storeLeaderboard() {
+	if err := g.leaderboard.Save(); err != nil {
+		log.Printf("Warning: Failed to save leaderboard: %v", err)
+	}
+}
+
+// endRun is called when the run is over, won or lost. A good enough score
+// asks for a name for the high score table. Endless mode carries on from
+// the win screen, so a run that already has a place there just moves it up.
+func (g *Game) endRun() {
+	g.boardRank = -1
+	if g.cheated {
+		return
+	}
+	if g.runEntry != nil {
+		g.boardRank = g.leaderboard.Raise(*g.runEntry, g.score, g.currentLevel)
+		g.setRunEntry()
+		g.storeLeaderboard()
+		return
+	}
+	if g.leaderboard.Qualifies(g.score) {
+		g.enteringName = true
+		g.nameInput = g.leaderboard.LastName
+	}
+}
+
+// setRunEntry remembers the run's place on the table after it changes
+func (g *Game) setRunEntry() {
+	g.runEntry = nil
+	if g.boardRank >= 0 {
+		entry := g.leaderboard.Scores[g.boardRank]
+		g.runEntry = &entry
+	}
+}
+
+func (g *Game) updateNameEntry() {
+	for _, r := range ebiten.AppendInputChars(nil) {
+		if len(g.nameInput) < maxNameLength && unicode.IsPrint(r) && r < unicode.MaxASCII {
+			g.nameInput += string(r)
+		}
+	}
+	if repeatingKeyPressed(ebiten.KeyBackspace) && len(g.nameInput) > 0 {
+		g.nameInput = g.nameInput[:len(g.nameInput)-1]
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		g.enteringName = false
+		return
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		name := cleanName(g.nameInput)
+		if name == "" {
+			return
+		}
+		g.enteringName = false
+		g.boardRank = g.leaderboard.Add(name, g.score, g.currentLevel)
+		g.setRunEntry()
+		g.storeLeaderboard()
+		g.audioManager.Play("click")
+		g.showLeaderboard()
+	}
+}
+
+// drawNameEntry draws the name prompt while one is open, returning whether
+// it did
+func (g *Game) drawNameEntry(screen *ebiten.Image, y int) bool {
+	if !g.enteringName {
+		return false
+	}
+	cursor := ""
+	if ebiten.Tick()/30%2 == 0 {
+		cursor = "_"
+	}
+	text.Draw(screen, "NEW HIGH SCORE! Enter your name:", basicfont.Face7x13, screenWidth/2-112, y, color.RGBA{255, 215, 0, 255})
+	text.Draw(screen, g.nameInput+cursor, basicfont.Face7x13, screenWidth/2-len(g.nameInput)*7/2, y+24, color.White)
+	text.Draw(screen, "Enter: Save  Esc: Skip", basicfont.Face7x13, screenWidth/2-77, y+50, color.RGBA{200, 200, 200, 255})
+	return true
+}
+
+// showLeaderboard opens the high score screen, going back to the current
+// screen when it's closed
+func (g *Game) showLeaderboard() {
+	g.returnState = g.state
+	g.state = StateLeaderboard
+}
+
+func (g *Game) updateLeaderboard() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeyH) {
+		g.state = g.returnState
+		g.audioManager.Play("click")
+	}
+}
+
+func (g *Game) drawLeaderboard(screen *ebiten.Image) {
+	lb := g.leaderboard
+	text.Draw(screen, "HIGH SCORES", basicfont.Face7x13, screenWidth/2-38, 80, color.RGBA{255, 215, 0, 255})
+
+	y := 130
+	if len(lb.Scores) == 0 {
+		text.Draw(screen, "No scores yet", basicfont.Face7x13, 60, y, color.RGBA{200, 200, 200, 255})
+	}
+	for i, s := range lb.Scores {
+		clr := color.Color(color.White)
+		if i == g.boardRank {
+			clr = color.RGBA{255, 215, 0, 255}
+		}
+		line := fmt.Sprintf("%2d. %-12s %7d  level %-3d %s", i+1, s.Name, s.Score, s.Level, s.Date)
+		text.Draw(screen, line, basicfont.Face7x13, 60, y, clr)
+		y += 20
+	}
+
+	y = 130
+	x := 520
+	text.Draw(screen, "Level  Fastest  Lives lost", basicfont.Face7x13, x, y-20, color.RGBA{200, 200, 200, 255})
+	levels := make([]int, 0, len(lb.Levels))
+	for level := range lb.Levels {
+		levels = append(levels, level)
+	}
+	sort.Ints(levels)
+	for _, level := range levels {
+		if y > screenHeight-90 {
+			break
+		}
+		best := lb.Levels[level]
+		text.Draw(screen, fmt.Sprintf("%5d  %7s  %d", level, formatTicks(best.Ticks), best.LivesLost), basicfont.Face7x13, x, y, color.White)
+		y += 20
+	}
+
+	text.Draw(screen, "Esc: Back", basicfont.Face7x13, screenWidth/2-31, screenHeight-40, color.RGBA{200, 200, 200, 255})
+}
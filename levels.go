@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"strconv"
+)
+
+// Car sprites by the name used in map objects
+var carSprites = map[string]string{
+	"limo":   limoAtlasPath,
+	"police": policeAtlasPath,
+}
+
+const (
+	defaultStartX = 100.0
+	defaultStartY = 100.0
+)
+
+func (o MapObject) Prop(name, def string) string {
+	if v, ok := o.Props[name]; ok {
+		return v
+	}
+	return def
+}
+
+func (o MapObject) PropFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(o.Prop(name, ""), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func (o MapObject) PropBool(name string) bool {
+	return o.Prop(name, "") == "true"
+}
+
+// spawnLevel puts the cat, NPCs, cars, items and portal where the level's
+// objects say. Random items fill in around the ones the map places.
+func (g *Game) spawnLevel() {
+	g.startX, g.startY = defaultStartX, defaultStartY
+	g.npcs = []*NPC{}
+	g.cars = []*Car{}
+	g.portalUnlocked = false
+	g.portal = NewPortal(float64(g.tileMap.Width()-150), float64(g.tileMap.Height()-150), g.loadAtlas(portalAtlasPath))
+
+	var placed []*Item
+	for _, obj := range g.levelObjects {
+		switch obj.Kind {
+		case "player":
+			g.startX, g.startY = obj.X, obj.Y
+		case "portal":
+			g.portal.x, g.portal.y = obj.X, obj.Y
+		case "npc":
+			g.npcs = append(g.npcs, g.newNPC(obj))
+		case "car":
+			if car := g.newCar(obj); car != nil {
+				g.cars = append(g.cars, car)
+			}
+		case "item":
+			species := g.itemRegistry.Get(obj.Prop("species", ""))
+			if species == nil {
+				log.Printf("Warning: %s places unknown item species %q", g.levelPath, obj.Prop("species", ""))
+				continue
+			}
+			placed = append(placed, NewSpeciesItem(obj.X, obj.Y, species))
+		default:
+			log.Printf("Warning: %s has unknown object type %q", g.levelPath, obj.Kind)
+		}
+	}
+
+	g.player.x, g.player.y = g.startX, g.startY
+
+	// Random items aren't shown in the editor
+	if g.state == StateEditor {
+		g.items = placed
+		return
+	}
+	g.noRoomForFish = false
+	g.spawnItems(placed)
+}
+
+// newNPC makes an NPC from a map object. Properties: range, horizontal,
+// static (portrait sprite that slides instead of walking) and dialogue.
+func (g *Game) newNPC(obj MapObject) *NPC {
+	moveRange := obj.PropFloat("range", 100)
+	horizontal := obj.PropBool("horizontal")
+	portrait := g.assets.Image(portraitPath)
+
+	var npc *NPC
+	if obj.PropBool("static") {
+		npc = NewStaticNPC(obj.X, obj.Y, portrait, moveRange, horizontal)
+	} else {
+		npc = NewAnimatedNPC(obj.X, obj.Y, g.loadAtlas(walkerAtlasPath), moveRange, horizontal)
+	}
+	if id := obj.Prop("dialogue", ""); id != "" {
+		npc.SetDialogue(id, portrait)
+	}
+	if npc.anim != nil {
+		// Footsteps are heard from where the NPC is
+		npc.anim.OnEvent = func(event string) {
+			x, y := npc.Center()
+			g.playAt(event, x, y, npcStepVolume)
+		}
+	}
+	return npc
+}
+
+// newCar makes a car from a map object. Properties: sprite (limo or police),
+// speed and road (horizontal or vertical, to drive only along a road).
+func (g *Game) newCar(obj MapObject) *Car {
+	sprite := obj.Prop("sprite", "limo")
+	atlas, ok := carSprites[sprite]
+	if !ok {
+		log.Printf("Warning: %s has a car with unknown sprite %q", g.levelPath, sprite)
+		return nil
+	}
+	lane := obj.Prop("road", "")
+	if lane != "" && lane != LaneHorizontal && lane != LaneVertical {
+		log.Printf("Warning: %s has a car on unknown road %q, it will roam", g.levelPath, lane)
+		lane = ""
+	}
+	return NewCar(obj.X, obj.Y, g.loadAtlas(atlas), obj.PropFloat("speed", 2.0), lane)
+}
@@ -1,16 +1,20 @@
 package main
 
 import (
-	"bytes"
 	"embed"
+	"flag"
 	"fmt"
 	"image/color"
 	"log"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
-	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/text"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"golang.org/x/image/font/basicfont"
 )
 
@@ -22,6 +26,26 @@ const (
 //go:embed assets
 var assetsFS embed.FS
 
+// rng drives all gameplay randomness so -seed can make runs repeatable
+var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// levelMaps is the TMX file for each level number
+var levelMaps = []string{
+	1: "assets/background/level1.tmx",
+	2: "assets/background/level2.tmx",
+	3: "assets/background/level3.tmx",
+}
+
+const (
+	walkAtlasPath   = "assets/sprites/walk_%d.json"
+	attackAtlasPath = "assets/sprites/attack_%d.json"
+	portalAtlasPath = "assets/items/Dimensional_Portal.json"
+	walkerAtlasPath = "assets/npc/walk and idle.json"
+	limoAtlasPath   = "assets/npc/Blue_LIMO_CLEAN_All_000-sheet.json"
+	policeAtlasPath = "assets/npc/POLICE_CLEAN_ALLD0000-sheet.json"
+	portraitPath    = "assets/npc/portrait female.png"
+)
+
 type GameState int
 
 const (
@@ -29,7 +53,13 @@ const (
 	StateGameOver
 	StateCarDeath // Special state for car collisions
 	StateGameWon
-	StateLifeLost // New state for when a life is lost but player still has lives remaining
+	StateLifeLost     // New state for when a life is lost but player still has lives remaining
+	StateDialogue     // Talking to an NPC, world is paused
+	StateEditor       // Level editor, world is paused
+	StateLevelResults // Score breakdown between levels
+	StateMenu         // Title screen
+	StateLeaderboard  // High scores, from the menu or the end screens
+	StateAchievements // Achievements list, from the menu
 )
 
 type Game struct {
@@ -39,225 +69,338 @@ type Game struct {
 	items          []*Item
 	portal         *Item
 	tileMap        *TileMap
+	levelPath      string // TMX file of the current level
+	mapFile        string // TMX file on disk played as level mapLevel: -map, or from the console
+	mapLevel       int
+	levelObjects   []MapObject
+	assets         *AssetManager
+	options        GameOptions
+	settings       Settings
+	debug          bool
+	console        *Console
+	editor         *Editor
+	godMode        bool // set from the console
+	engines        map[*Car]*Voice
 	camera         *Camera
 	world          *ebiten.Image
 	state          GameState
 	currentLevel   int
 	itemsCollected int
 	portalUnlocked bool
+	startX, startY float64 // where the cat starts the level and respawns
 	audioManager   *AudioManager
 	lives          int
 	lifeLostTimer  int // Timer to show "life lost" screen briefly
+	dialogues      map[string]*Dialogue
+	dialogueFlags  map[string]bool // Set by dialogue effects, reset on restart
+	dialogue       *DialogueSession
+	quests         *QuestLog
+	fishBySpecies  map[string]int // Fish collected this level, by species name
+	noRoomForFish  bool           // topUpFish has warned it couldn't place any on this level
+	toastText      string         // Short message shown under the HUD
+	toastTimer     int
+
+	itemRegistry *ItemRegistry
+	score        int          // Whole run, see scoring.go
+	levelScore   LevelScore   // Level being played
+	results      []LevelScore // Levels finished this run
+	combo        int          // Fish eaten in quick succession
+	comboTimer   int          // Ticks left to keep the combo going
+	leaderboard  *Leaderboard
+	enteringName bool // typing a name for the high score table
+	nameInput    string
+	boardRank    int        // place just added to the high scores, -1 for none
+	runEntry     *HighScore // this run's high score, nil until it has one
+	returnState  GameState  // screen to go back to from the high scores or achievements
+	achievements *Achievements
+
+	personalBest   *PersonalBest
+	runCounts      bool           // the run can set a personal best
+	cheated        bool           // a cheat, the editor or a quick load was used, achievements don't count
+	ghostRecording [][]ghostFrame // the cat on each level of this run
+	newPB          bool           // the run just set a personal best
+
+	events *EventBus     // gameplay events, see events.go
+	stats  *SessionStats // counted from events since the game started
+}
 
-	goldfishImg       *ebiten.Image
-	rainbowTroutImg   *ebiten.Image
-	angelfishImg      *ebiten.Image
-	bassImg           *ebiten.Image
-	catfishImg        *ebiten.Image
-	wormImg           *ebiten.Image
-	badItemImg        *ebiten.Image
-	portalImg         *ebiten.Image
-	femalePortraitImg *ebiten.Image
-	femaleWalkImg     *ebiten.Image
-	blueCarImg        *ebiten.Image
-	policeCarImg      *ebiten.Image
+// GameOptions are the command line settings the game starts (and restarts) with
+type GameOptions struct {
+	Level   int
+	Lives   int
+	MapFile string // TMX file on disk used for the start level instead of its own map
+	Seed    int64  // also picks the endless mode maps
+	Mute    bool
+	Debug   bool
+	Audio   string // backend: auto, ebiten or null
 }
 
-func NewGame() *Game {
+func NewGame(assets *AssetManager, opts GameOptions) *Game {
 	g := &Game{
-		state:        StatePlaying,
-		currentLevel: 1,
-		camera:       Init(screenWidth, screenHeight),
-		audioManager: NewAudioManager(),
-		lives:        3, // Start with 3 lives
+		state:         StateMenu,
+		currentLevel:  opts.Level,
+		camera:        Init(screenWidth, screenHeight),
+		assets:        assets,
+		options:       opts,
+		mapFile:       opts.MapFile,
+		mapLevel:      opts.Level,
+		settings:      loadSettings(),
+		debug:         opts.Debug,
+		audioManager:  NewAudioManager(assets, newAudioBackend(opts.Audio)),
+		lives:         opts.Lives,
+		dialogues:     loadDialogues(assets.FS(), dialogueDir),
+		dialogueFlags: make(map[string]bool),
+		quests:        NewQuestLog(assets.FS(), questsFile),
+		console:       NewConsole(),
+		engines:       make(map[*Car]*Voice),
+		leaderboard:   loadLeaderboard(),
+		achievements:  NewAchievements(assets.FS(), achievementsFile),
+		boardRank:     -1,
+		personalBest:  loadPersonalBest(),
+		events:        NewEventBus(),
+		stats:         NewSessionStats(),
+	}
+	g.subscribe()
+	assets.OnReload = g.onAssetReload
+	g.registerCommands()
+	g.registerEditorCommands()
+
+	var err error
+	g.itemRegistry, err = LoadItemRegistry(assets.FS(), itemsFile, assets.Image)
+	if err != nil {
+		log.Fatal("Failed to load item registry:", err)
 	}
 
-	g.loadAssets()
-	g.loadLevel(1)
+	g.startRun()
+	g.loadLevel(opts.Level)
 
-	// Start background music
-	g.audioManager.PlayBackgroundMusic()
+	g.applySettings()
 
 	return g
 }
 
-func (g *Game) loadAssets() {
-	g.goldfishImg = g.loadImageFromFS("assets/items/Goldfish.png")
-	g.rainbowTroutImg = g.loadImageFromFS("assets/items/Rainbow Trout.png")
-	g.angelfishImg = g.loadImageFromFS("assets/items/Angelfish.png")
-	g.bassImg = g.loadImageFromFS("assets/items/Bass.png")
-	g.catfishImg = g.loadImageFromFS("assets/items/Catfish.png")
-	g.wormImg = g.loadImageFromFS("assets/items/Worm.png")
-	g.badItemImg = g.loadImageFromFS("assets/items/Rusty Can.png")
-	g.portalImg = g.loadImageFromFS("assets/items/Dimensional_Portal.png")
-	g.femalePortraitImg = g.loadImageFromFS("assets/npc/portrait female.png")
-	g.femaleWalkImg = g.loadImageFromFS("assets/npc/walk and idle.png")
-	g.blueCarImg = g.loadImageFromFS("assets/npc/Blue_LIMO_CLEAN_All_000-sheet.png")
-	g.policeCarImg = g.loadImageFromFS("assets/npc/POLICE_CLEAN_ALLD0000-sheet.png")
+// loadAtlas loads a sprite sheet and its animation metadata
+func (g *Game) loadAtlas(path string) *Atlas {
+	atlas, err := g.assets.Atlas(path)
+	if err != nil {
+		log.Fatal("Failed to load atlas:", err)
+	}
+	return atlas
 }
 
-func (g *Game) loadImageFromFS(path string) *ebiten.Image {
-	data, err := assetsFS.ReadFile(path)
-	if err != nil {
-		log.Printf("Warning: Failed to load %s: %v", path, err)
-		img := ebiten.NewImage(64, 64)
-		img.Fill(color.RGBA{255, 0, 255, 255}) // Magenta placeholder
-		return img
+// preloadAssets loads everything the game can use up front so strict mode
+// can report every missing asset at once
+func preloadAssets(am *AssetManager) {
+	for _, path := range levelMaps[1:] {
+		am.TileMap(path)
 	}
+	for i := 1; i <= 8; i++ {
+		am.Atlas(fmt.Sprintf(walkAtlasPath, i))
+		am.Atlas(fmt.Sprintf(attackAtlasPath, i))
+	}
+	for _, path := range []string{portalAtlasPath, walkerAtlasPath, limoAtlasPath, policeAtlasPath} {
+		am.Atlas(path)
+	}
+	am.Image(portraitPath)
+	LoadItemRegistry(am.FS(), itemsFile, am.Image)
+	if sounds, err := LoadSoundRegistry(am.FS(), soundsFile); err == nil {
+		for _, path := range append(sounds.Files(), sounds.MusicFiles()...) {
+			am.ReadFile(path)
+		}
+	}
+}
 
-	img, _, err := ebitenutil.NewImageFromReader(bytes.NewReader(data))
-	if err != nil {
-		log.Printf("Warning: Failed to decode %s: %v", path, err)
-		img := ebiten.NewImage(64, 64)
-		img.Fill(color.RGBA{255, 0, 255, 255})
-		return img
+// onAssetReload is called in dev mode when an asset file changes on disk
+func (g *Game) onAssetReload(path string) {
+	if path != g.levelPath {
+		return
 	}
 
-	return img
+	tileMap, err := g.assets.TileMap(path)
+	if err != nil {
+		log.Printf("Warning: Failed to reload %s: %v", path, err)
+		return
+	}
+	g.tileMap = tileMap
+	if g.world.Bounds().Dx() != tileMap.Width() || g.world.Bounds().Dy() != tileMap.Height() {
+		g.world = ebiten.NewImage(tileMap.Width(), tileMap.Height())
+	}
 }
 
 func (g *Game) loadLevel(level int) {
-	var tmxData []byte
-	var tilesetImages map[string]*ebiten.Image
 	var err error
 
-	if level == 1 {
-		tmxData, err = assetsFS.ReadFile("assets/background/level1.tmx")
-		if err != nil {
-			log.Fatal("Failed to load level1.tmx:", err)
-		}
-
-		img := g.loadImageFromFS("assets/background/orig_big copy.png")
-		tilesetImages = map[string]*ebiten.Image{
-			"orig_big copy.png": img,
-		}
-
-		// Create player for level 1 - Cat character with all 8 directions
-		var walkSprites [8]*ebiten.Image
-
-		// Load all 8 walk sprites
-		for i := 0; i < 8; i++ {
-			walkSprites[i] = g.loadImageFromFS(fmt.Sprintf("assets/sprites/walk_%d.png", i+1))
-		}
-
-		g.player = NewPlayer(100, 100, walkSprites)
-
-		// No NPCs on level 1
-		g.npcs = []*NPC{}
-		g.cars = []*Car{} // No cars either
-
-	} else if level == 2 {
-		tmxData, err = assetsFS.ReadFile("assets/background/level2.tmx")
-		if err != nil {
-			log.Fatal("Failed to load level2.tmx:", err)
-		}
-
-		tilesetImages = map[string]*ebiten.Image{
-			"clay_tile_64_01.png":      g.loadImageFromFS("assets/background/clay_tile_64_01.png"),
-			"grass_01_tile_64_01.png":  g.loadImageFromFS("assets/background/grass_01_tile_64_01.png"),
-			"ice_tile_64_01.png":       g.loadImageFromFS("assets/background/ice_tile_64_01.png"),
-			"paving_01_tile_64_02.png": g.loadImageFromFS("assets/background/paving_01_tile_64_02.png"),
-			"paving_02_tile_64_01.png": g.loadImageFromFS("assets/background/paving_02_tile_64_01.png"),
-			"sand_01_tile_64_01.png":   g.loadImageFromFS("assets/background/sand_01_tile_64_01.png"),
-		}
-
-		g.player.x = 100
-		g.player.y = 100
+	// Fresh cat on level 1, or whatever level the game started on
+	if level == 1 || g.player == nil {
+		g.player = g.newPlayer()
+	}
 
-		// Add NPCs to level 2
-		g.npcs = []*NPC{
-			NewAnimatedNPC(400, 300, g.femaleWalkImg, 24, 24, 8, 150, true),
-			NewAnimatedNPC(800, 200, g.femaleWalkImg, 24, 24, 8, 100, false),
-			NewStaticNPC(600, 500, g.femalePortraitImg, 80, false),
-			NewStaticNPC(300, 600, g.femalePortraitImg, 120, true),
-		}
+	if g.mapFile != "" && level == g.mapLevel {
+		g.levelPath = g.mapFile
+		g.tileMap, err = loadMapFile(g.mapFile)
+	} else if level < len(levelMaps) {
+		g.levelPath = levelMaps[level]
+		g.tileMap, err = g.assets.TileMap(g.levelPath)
+	} else {
+		g.levelPath, g.tileMap, err = g.generateLevel(level)
+	}
+	if err != nil {
+		log.Fatal("Failed to load tilemap:", err)
+	}
 
-		g.cars = []*Car{
-			NewCar(500, 400, g.blueCarImg, 2.0),
-		}
+	g.world = ebiten.NewImage(g.tileMap.Width(), g.tileMap.Height())
+	g.levelObjects = g.tileMap.Objects()
+	g.fishBySpecies = make(map[string]int)
+	g.startLevelScore(level)
+	g.spawnLevel()
+	g.quests.OnLevelStart(level)
+	g.audioManager.music.Play(g.tileMap.Property("music"))
+}
 
-	} else if level == 3 {
-		tmxData, err = assetsFS.ReadFile("assets/background/level3.tmx")
-		if err != nil {
-			log.Fatal("Failed to load level3.tmx:", err)
+// spawnItems scatters fish, power-ups and hazards using the placement rules
+// in items.json, around any the map places itself, until the level has as
+// many of each kind as it should. The cat, portal and cars must already be
+// placed.
+func (g *Game) spawnItems(placed []*Item) {
+	g.items = placed
+	good, powerUps := 0, 0
+	bad := make(map[*ItemSpecies]int)
+	for _, item := range placed {
+		switch item.itemType {
+		case ItemGood:
+			good++
+		case ItemPowerUp:
+			powerUps++
+		case ItemBad:
+			bad[item.species]++
 		}
+	}
 
-		img := g.loadImageFromFS("assets/background/orig_big1.png")
-		tilesetImages = map[string]*ebiten.Image{
-			"orig_big1.png": img,
+	placer := g.newItemPlacer()
+	missing := 0
+	place := func(species *ItemSpecies) {
+		if item := placer.Place(species); item != nil {
+			g.items = append(g.items, item)
+		} else {
+			missing++
 		}
+	}
 
-		g.player.x = 100
-		g.player.y = 100
+	for i := good; i < g.itemRegistry.GoodPerLevel; i++ {
+		place(g.itemRegistry.PickGood())
+	}
 
-		g.npcs = []*NPC{
-			NewAnimatedNPC(300, 250, g.femaleWalkImg, 24, 24, 8, 200, true),
-			NewAnimatedNPC(900, 300, g.femaleWalkImg, 24, 24, 8, 180, true),
-			NewAnimatedNPC(600, 400, g.femaleWalkImg, 24, 24, 8, 150, false),
-			NewAnimatedNPC(450, 600, g.femaleWalkImg, 24, 24, 8, 120, false),
-			NewStaticNPC(750, 150, g.femalePortraitImg, 100, true),
-			NewStaticNPC(200, 500, g.femalePortraitImg, 130, false),
+	for i := powerUps; i < g.itemRegistry.PowerUpPerLevel; i++ {
+		species := g.itemRegistry.PickPowerUp()
+		if species == nil {
+			break
 		}
+		place(species)
+	}
 
-		g.cars = []*Car{
-			NewCar(400, 200, g.blueCarImg, 2.5),
-			NewCar(700, 500, g.policeCarImg, 3.0),
+	for _, species := range g.itemRegistry.Bad() {
+		for i := bad[species]; i < species.PerLevel; i++ {
+			place(species)
 		}
 	}
 
-	g.tileMap, err = NewTileMap(tmxData, tilesetImages)
-	if err != nil {
-		log.Fatal("Failed to load tilemap:", err)
+	if missing > 0 {
+		log.Printf("Warning: no room for %d random items on %s", missing, g.levelPath)
 	}
-
-	g.world = ebiten.NewImage(g.tileMap.Width(), g.tileMap.Height())
-	g.spawnItems()
 }
 
-func (g *Game) spawnItems() {
-	g.items = []*Item{}
-	g.portalUnlocked = false
+func (g *Game) Update() error {
+	g.assets.Update()
+	if ebiten.Tick()%achievementFlushTicks == 0 {
+		g.achievements.Flush()
+	}
+
+	// Music is quieter under dialogue and the end screens
+	g.audioManager.music.SetDucked(g.state == StateDialogue || g.state == StateGameOver || g.state == StateCarDeath || g.state == StateGameWon || g.state == StateLevelResults)
+	g.audioManager.Update()
+	g.updateSpatialAudio()
 
-	mapWidth := g.tileMap.Width()
-	mapHeight := g.tileMap.Height()
+	// Name entry and the editor have keys of their own, so the global keys
+	// are left to them while they're open
+	globalKeys := !g.enteringName && g.state != StateEditor
 
-	goodItems := []*ebiten.Image{
-		g.goldfishImg,
-		g.rainbowTroutImg,
-		g.angelfishImg,
-		g.bassImg,
-		g.catfishImg,
+	if globalKeys && inpututil.IsKeyJustPressed(ebiten.KeyF3) {
+		g.debug = !g.debug
 	}
 
-	for i := 0; i < 17; i++ {
-		x := float64(rand.Intn(mapWidth-100) + 50)
-		y := float64(rand.Intn(mapHeight-100) + 50)
-		img := goodItems[rand.Intn(len(goodItems))]
-		g.items = append(g.items, NewItem(x, y, ItemGood, img))
+	// The game is paused while the console is open
+	if g.console.open {
+		g.updateConsole()
+		return nil
+	}
+	if globalKeys && inpututil.IsKeyJustPressed(ebiten.KeyBackquote) {
+		g.console.open = true
+		return nil
 	}
 
-	for i := 0; i < 3; i++ {
-		x := float64(rand.Intn(mapWidth-100) + 50)
-		y := float64(rand.Intn(mapHeight-100) + 50)
+	if g.toastTimer > 0 {
+		g.toastTimer--
+	}
+	g.achievements.Update()
 
-		g.items = append(g.items, NewItem(x, y, ItemBad, g.badItemImg))
+	if globalKeys && inpututil.IsKeyJustPressed(ebiten.KeyM) {
+		g.toggleMute()
 	}
 
-	for i := 0; i < 2; i++ {
-		x := float64(rand.Intn(mapWidth-100) + 50)
-		y := float64(rand.Intn(mapHeight-100) + 50)
+	if g.state == StatePlaying {
+		if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+			g.quests.open = !g.quests.open
+			g.audioManager.Play("click")
+		}
+		if g.quests.open {
+			return nil
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF2) {
+			g.startEditor()
+			return nil
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+			g.toggleGhost()
+		}
+		if repeatingKeyPressed(ebiten.KeyMinus) {
+			g.changeVolume(-0.1)
+		}
+		if repeatingKeyPressed(ebiten.KeyEqual) {
+			g.changeVolume(0.1)
+		}
 
-		g.items = append(g.items, NewItem(x, y, ItemBad, g.wormImg))
-	}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF5) {
+			if err := g.saveGame(); err != nil {
+				log.Printf("Warning: Failed to save game: %v", err)
+				g.showToast("Save failed")
+			} else {
+				g.showToast("Game saved")
+			}
+			g.audioManager.Play("click")
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+			if err := g.loadGame(); err != nil {
+				log.Printf("Warning: Failed to load game: %v", err)
+				g.showToast("No save to load")
+			} else {
+				g.showToast("Game loaded")
+			}
+			g.audioManager.Play("click")
+			return nil
+		}
 
-	portalX := float64(mapWidth - 150)
-	portalY := float64(mapHeight - 150)
-	g.portal = NewItem(portalX, portalY, ItemPortal, g.portalImg)
-}
+		if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+			if npc := g.nearestTalkableNPC(); npc != nil {
+				g.startDialogue(npc)
+				return nil
+			}
+		}
 
-func (g *Game) Update() error {
-	if g.state == StatePlaying {
+		g.updateTimer()
+		g.updateScore()
+		prevX, prevY := g.player.x, g.player.y
 		g.player.Update(g.tileMap.Width(), g.tileMap.Height())
+		g.keepOutOfWalls(prevX, prevY)
 
 		for _, npc := range g.npcs {
 			npc.Update()
@@ -266,86 +409,105 @@ func (g *Game) Update() error {
 		for _, car := range g.cars {
 			car.Update(g.tileMap.Width(), g.tileMap.Height())
 		}
-		g.portal.Update()
+		pcx := g.player.x + float64(g.player.width)/2
+		pcy := g.player.y + float64(g.player.height)/2
+		for _, item := range g.items {
+			item.Update(pcx, pcy, g.tileMap.Width(), g.tileMap.Height())
+		}
+		g.portal.Update(pcx, pcy, g.tileMap.Width(), g.tileMap.Height())
+		g.applyMagnet()
+		if ebiten.Tick()%ebiten.DefaultTPS == 0 {
+			g.topUpFish()
+		}
 		g.camera.Follow.W = int(g.player.x + float64(g.player.width)/2)
 		g.camera.Follow.H = int(g.player.y + float64(g.player.height)/2)
 
+		// A handler that changes the screen (life lost, game over, level
+		// done) ends the tick, so one tick can't lose two lives or end the
+		// run twice
 		px, py, pw, ph := g.player.GetBounds()
 		for _, item := range g.items {
-			if item.CheckCollision(px, py, pw, ph) {
+			if item.CheckCollision(px, py, pw, ph) || g.caughtBySwipe(item) {
 				item.collected = true
-				// Play eating sound effect
-				g.audioManager.PlayEatSound()
-				if item.itemType == ItemGood {
-					g.itemsCollected++
-					
-					if g.itemsCollected >= 9 {
-						g.portalUnlocked = true
-					}
-				} else if item.itemType == ItemBad {
-					g.audioManager.PlayOuchSound() // Play ouch sound when eating bad item
-					g.lives--
-					if g.lives > 0 {
-						g.state = StateLifeLost
-						g.lifeLostTimer = 90 
-					} else {
-						g.state = StateGameOver
-					}
+				Publish(g.events, ItemCollected{Item: item})
+				if item.itemType == ItemBad && !item.species.Harmless && !g.invulnerable() {
+					Publish(g.events, PlayerHit{Item: item})
+				}
+				if g.state != StatePlaying {
+					return nil
 				}
 			}
 		}
 
 		for _, car := range g.cars {
+			if g.invulnerable() {
+				break
+			}
 			if car.CheckCollision(px, py, pw, ph) {
-				g.audioManager.PlayCarHonkSound() // Play car honk sound when hit by car
-				g.lives--
-				if g.lives > 0 {
-					g.state = StateLifeLost
-					g.lifeLostTimer = 90 
-				} else {
-					g.state = StateCarDeath
-				}
+				Publish(g.events, PlayerHit{Car: car})
+			} else if car.NearMiss(px, py, pw, ph) {
+				Publish(g.events, CarNearMiss{Car: car})
+			}
+			if g.state != StatePlaying {
+				return nil
 			}
 		}
 
+		g.quests.Update(g)
+		if !g.portalUnlocked && g.quests.ObjectiveDone() {
+			g.unlockPortal()
+		}
+		if g.state != StatePlaying {
+			return nil
+		}
+
 		if g.portalUnlocked && g.portal.CheckCollision(px, py, pw, ph) {
-			if g.currentLevel == 1 {
-				g.currentLevel = 2
-				g.itemsCollected = 0
-				g.loadLevel(2)
-				g.state = StatePlaying
-			} else if g.currentLevel == 2 {
-				// Move to level 3 - FINAL LEVEL!
-				g.currentLevel = 3
-				g.itemsCollected = 0
-				g.loadLevel(3)
-				g.state = StatePlaying
-			} else {
-				g.state = StateGameWon
-			}
+			g.finishLevelScore()
+			Publish(g.events, LevelCompleted{Score: g.results[len(g.results)-1], Final: g.currentLevel == 3})
+		}
+	} else if g.state == StateMenu {
+		g.updateMenu()
+	} else if g.state == StateLeaderboard {
+		g.updateLeaderboard()
+	} else if g.state == StateAchievements {
+		g.updateAchievements()
+	} else if g.state == StateLevelResults {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+			g.audioManager.Play("click")
+			g.nextLevel()
 		}
+	} else if g.state == StateDialogue {
+		g.updateTimer()
+		g.updateDialogue()
+	} else if g.state == StateEditor {
+		g.updateEditor()
 	} else if g.state == StateLifeLost {
+		g.updateTimer()
+		g.player.anim.Update()
 		g.lifeLostTimer--
 		if g.lifeLostTimer <= 0 {
-			g.player.x = 100
-			g.player.y = 100
+			g.player.x, g.player.y = g.startX, g.startY
+			g.player.ClearStatuses()
 			g.state = StatePlaying
 		}
+	} else if g.enteringName {
+		g.updateNameEntry()
 	} else if g.state == StateGameOver || g.state == StateCarDeath {
 		if ebiten.IsKeyPressed(ebiten.KeyR) {
-			g.state = StatePlaying
-			g.currentLevel = 1
-			g.itemsCollected = 0
-			g.lives = 3 
-			g.loadLevel(1)
+			g.restart()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+			g.showLeaderboard()
 		}
 	} else if g.state == StateGameWon {
 		if ebiten.IsKeyPressed(ebiten.KeyR) {
-			g.state = StatePlaying
-			g.currentLevel = 1
-			g.itemsCollected = 0
-			g.lives = 3 
-			g.loadLevel(1)
+			g.restart()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+			g.startEndless()
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+			g.showLeaderboard()
 		}
 	}
 
@@ -356,31 +518,35 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	screen.Fill(color.RGBA{50, 50, 50, 255})
 
 	if g.state == StatePlaying {
-		g.world.Clear()
+		g.drawWorld(screen)
+		g.drawTalkPrompt(screen)
+		g.drawUI(screen)
+		g.quests.Draw(screen)
 
-		g.tileMap.Draw(g.world, 0, 0)
+	} else if g.state == StateDialogue {
+		g.drawWorld(screen)
+		g.drawUI(screen)
+		g.drawDialogue(screen)
 
-		for _, item := range g.items {
-			item.Draw(g.world, 0, 0)
-		}
+	} else if g.state == StateEditor {
+		g.drawEditor(screen)
+		g.drawToast(screen, 70)
 
-		if g.portalUnlocked {
-			g.portal.DrawWithAlpha(g.world, 0, 0, 1.0)
-		} else {
-			g.portal.DrawWithAlpha(g.world, 0, 0, 0.3)
-		}
+	} else if g.state == StateMenu {
+		g.drawWorld(screen)
+		vector.FillRect(screen, 0, 0, screenWidth, screenHeight, color.RGBA{0, 0, 0, 190}, false)
+		g.drawMenu(screen)
 
-		for _, npc := range g.npcs {
-			npc.Draw(g.world, 0, 0)
-		}
+	} else if g.state == StateLeaderboard {
+		g.drawLeaderboard(screen)
 
-		for _, car := range g.cars {
-			car.Draw(g.world, 0, 0)
-		}
+	} else if g.state == StateAchievements {
+		g.drawAchievements(screen)
 
-		g.player.Draw(g.world, 0, 0)
-		g.camera.Draw(g.world, screen)
-		g.drawUI(screen)
+	} else if g.state == StateLevelResults {
+		g.drawWorld(screen)
+		vector.FillRect(screen, 0, 0, screenWidth, screenHeight, color.RGBA{0, 0, 0, 190}, false)
+		g.drawLevelResults(screen)
 
 	} else if g.state == StateLifeLost {
 		// Draw dimmed game world
@@ -407,19 +573,152 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	} else if g.state == StateGameOver {
 		text.Draw(screen, "GAME OVER!", basicfont.Face7x13, screenWidth/2-50, screenHeight/2, color.White)
 		text.Draw(screen, "You touched a bad item!", basicfont.Face7x13, screenWidth/2-90, screenHeight/2+20, color.White)
-		text.Draw(screen, "Press R to restart", basicfont.Face7x13, screenWidth/2-80, screenHeight/2+40, color.White)
+		g.drawRunOver(screen, screenHeight/2+40)
 	} else if g.state == StateCarDeath {
 		text.Draw(screen, "GAME OVER!", basicfont.Face7x13, screenWidth/2-50, screenHeight/2-20, color.White)
 		text.Draw(screen, "Cats only have 1 life around here!", basicfont.Face7x13, screenWidth/2-120, screenHeight/2, color.White)
-		text.Draw(screen, "Press R to restart", basicfont.Face7x13, screenWidth/2-80, screenHeight/2+40, color.White)
+		g.drawRunOver(screen, screenHeight/2+40)
 	} else if g.state == StateGameWon {
-		text.Draw(screen, "CONGRATULATIONS!", basicfont.Face7x13, screenWidth/2-70, screenHeight/2-20, color.White)
-		text.Draw(screen, "YOU BEAT ALL 3 LEVELS!", basicfont.Face7x13, screenWidth/2-100, screenHeight/2, color.White)
-		text.Draw(screen, "You are a true Cat Champion!", basicfont.Face7x13, screenWidth/2-110, screenHeight/2+20, color.White)
-		text.Draw(screen, fmt.Sprintf("Final score: %d fish collected", g.itemsCollected), basicfont.Face7x13, screenWidth/2-120, screenHeight/2+40, color.White)
-		text.Draw(screen, "Press R to play again", basicfont.Face7x13, screenWidth/2-90, screenHeight/2+70, color.White)
+		text.Draw(screen, "CONGRATULATIONS!", basicfont.Face7x13, screenWidth/2-70, 140, color.White)
+		text.Draw(screen, "YOU BEAT ALL 3 LEVELS!", basicfont.Face7x13, screenWidth/2-100, 160, color.White)
+		text.Draw(screen, "You are a true Cat Champion!", basicfont.Face7x13, screenWidth/2-110, 180, color.White)
+		timeText := "Time: " + formatTicks(g.runTicks())
+		if g.newPB {
+			timeText += "  NEW PERSONAL BEST!"
+		}
+		text.Draw(screen, timeText, basicfont.Face7x13, screenWidth/2-len(timeText)*7/2, 205, color.RGBA{255, 215, 0, 255})
+		y := g.drawFinalScore(screen, 230)
+		if !g.drawNameEntry(screen, y+30) {
+			text.Draw(screen, "Press R to play again", basicfont.Face7x13, screenWidth/2-90, y+30, color.White)
+			text.Draw(screen, "Press N for endless mode", basicfont.Face7x13, screenWidth/2-90, y+50, color.White)
+			text.Draw(screen, "Press H for high scores", basicfont.Face7x13, screenWidth/2-90, y+70, color.White)
+		}
+	}
+
+	g.achievements.DrawToast(screen)
+	if g.debug {
+		g.drawDebug(screen)
+	}
+	g.console.Draw(screen)
+}
+
+// drawRunOver is the bottom of the game over screens: the score, and then
+// either the high score name entry or what to press next
+func (g *Game) drawRunOver(screen *ebiten.Image, y int) {
+	text.Draw(screen, fmt.Sprintf("Score: %d", g.score), basicfont.Face7x13, screenWidth/2-50, y, color.White)
+	if !g.drawNameEntry(screen, y+40) {
+		text.Draw(screen, "Press R to restart", basicfont.Face7x13, screenWidth/2-80, y+30, color.White)
+		text.Draw(screen, "Press H for high scores", basicfont.Face7x13, screenWidth/2-80, y+50, color.White)
+	}
+}
+
+// invulnerable is true when hazards and cars can't cost a life
+func (g *Game) invulnerable() bool {
+	return g.godMode || g.player.HasStatus(StatusInvincible)
+}
+
+// cursorWorld is the mouse position on the map
+func (g *Game) cursorWorld() (float64, float64) {
+	mx, my := ebiten.CursorPosition()
+	return g.camera.ScreenToWorld(float64(mx), float64(my))
+}
+
+// onPlayerAnimEvent handles events fired on specific frames of the cat's
+// animations
+func (g *Game) onPlayerAnimEvent(event string) {
+	switch event {
+	case "swipe":
+		g.resolvePounce()
+	}
+	// Any event with a sound in sounds.json plays it, e.g. "footstep"
+	g.audioManager.Play(event)
+}
+
+// unlockPortal opens the portal, announcing it the first time
+func (g *Game) unlockPortal() {
+	if g.portalUnlocked {
+		return
 	}
+	g.portalUnlocked = true
+	Publish(g.events, PortalUnlocked{Level: g.currentLevel})
 }
+
+// nextLevel moves on from the results screen, into endless mode after
+// level 3
+func (g *Game) nextLevel() {
+	g.currentLevel++
+	g.itemsCollected = 0
+	g.loadLevel(g.currentLevel)
+	g.state = StatePlaying
+}
+
+// restart resets the run back to level 1
+func (g *Game) restart() {
+	g.state = StatePlaying
+	g.currentLevel = g.options.Level
+	g.itemsCollected = 0
+	g.results = nil
+	g.enteringName = false
+	g.runEntry = nil
+	g.startRun()
+	g.lives = g.options.Lives
+	g.dialogueFlags = make(map[string]bool)
+	g.quests.Reset()
+	g.player = nil
+	g.mapFile, g.mapLevel = g.options.MapFile, g.options.Level
+	g.loadLevel(g.options.Level)
+}
+
+// newPlayer creates the cat with all 8 directions
+func (g *Game) newPlayer() *Player {
+	var walkAtlases []*Atlas
+	var attackAtlases []*Atlas
+
+	// Load all 8 walk and attack sprites
+	for i := 0; i < 8; i++ {
+		walkAtlases = append(walkAtlases, g.loadAtlas(fmt.Sprintf(walkAtlasPath, i+1)))
+		attackAtlases = append(attackAtlases, g.loadAtlas(fmt.Sprintf(attackAtlasPath, i+1)))
+	}
+
+	p := NewPlayer(100, 100, walkAtlases, attackAtlases)
+	p.anim.OnEvent = g.onPlayerAnimEvent
+	return p
+}
+
+// loadMapFile loads a TMX file from disk, with tileset images relative to it
+func loadMapFile(file string) (*TileMap, error) {
+	return NewAssetManager(os.DirFS(filepath.Dir(file)), "").TileMap(filepath.Base(file))
+}
+
+// drawWorld renders the level and everything in it through the camera
+func (g *Game) drawWorld(screen *ebiten.Image) {
+	g.world.Clear()
+
+	g.tileMap.Draw(g.world, 0, 0)
+
+	for _, item := range g.items {
+		item.Draw(g.world, 0, 0)
+	}
+
+	if g.portalUnlocked {
+		g.portal.DrawWithAlpha(g.world, 0, 0, 1.0)
+	} else {
+		g.portal.DrawWithAlpha(g.world, 0, 0, 0.3)
+	}
+
+	for _, npc := range g.npcs {
+		npc.Draw(g.world, 0, 0)
+	}
+
+	for _, car := range g.cars {
+		car.Draw(g.world, 0, 0)
+	}
+
+	g.drawGhost()
+	g.player.Draw(g.world, 0, 0)
+	g.camera.Draw(g.world, screen)
+}
+
 func (g *Game) getHeartsString() string {
 	hearts := ""
 	for i := 0; i < g.lives; i++ {
@@ -439,17 +738,39 @@ func (g *Game) drawUI(screen *ebiten.Image) {
 	livesText := fmt.Sprintf("Lives: %s", g.getHeartsString())
 	text.Draw(screen, livesText, basicfont.Face7x13, 120, 20, color.RGBA{255, 100, 100, 255})
 
-	collectionText := fmt.Sprintf("Fish Collected: %d", g.itemsCollected)
+	collectionText := fmt.Sprintf("Fish Collected: %d  Score: %d", g.itemsCollected, g.score)
 	text.Draw(screen, collectionText, basicfont.Face7x13, 10, 35, color.White)
 
-	portalText := "Portal: Locked (Need 9 fish)"
+	portalText := "Portal: Locked"
+	if goal := g.quests.ObjectiveText(); goal != "" {
+		portalText += " (" + goal + ")"
+	}
 	if g.portalUnlocked {
 		portalText = "Portal: UNLOCKED! Go to portal!"
 	}
 	text.Draw(screen, portalText, basicfont.Face7x13, screenWidth-250, 20, color.RGBA{255, 215, 0, 255})
 
-	controlsText := "WASD/Arrows: Move"
-	text.Draw(screen, controlsText, basicfont.Face7x13, screenWidth-250, 35, color.RGBA{200, 200, 200, 255})
+	controlsText := "Move: WASD  Pounce: Space  Talk: E  Quests: Q"
+	text.Draw(screen, controlsText, basicfont.Face7x13, screenWidth-len(controlsText)*7-10, 35, color.RGBA{200, 200, 200, 255})
+
+	g.quests.drawTracker(screen)
+	g.drawTimer(screen)
+	g.drawCombo(screen)
+	g.drawStatusIcons(screen)
+
+	g.drawToast(screen, 80)
+}
+
+func (g *Game) drawToast(screen *ebiten.Image, y int) {
+	if g.toastTimer > 0 {
+		text.Draw(screen, g.toastText, basicfont.Face7x13, screenWidth/2-len(g.toastText)*7/2, y, color.White)
+	}
+}
+
+// showToast flashes a short message under the HUD for a couple of seconds
+func (g *Game) showToast(msg string) {
+	g.toastText = msg
+	g.toastTimer = 150
 }
 
 func (g *Game) Layout(_ int, _ int) (int, int) {
@@ -457,12 +778,60 @@ func (g *Game) Layout(_ int, _ int) (int, int) {
 }
 
 func main() {
-	ebiten.SetWindowSize(screenWidth, screenHeight)
+	var opts GameOptions
+	flag.IntVar(&opts.Level, "level", 1, "level to start on (1-3)")
+	flag.IntVar(&opts.Lives, "lives", 3, "starting lives")
+	flag.StringVar(&opts.MapFile, "map", "", "TMX file on disk to play instead of the start level's map")
+	flag.BoolVar(&opts.Mute, "mute", false, "start with sound off")
+	flag.StringVar(&opts.Audio, "audio", "auto", "audio backend: ebiten, null (silent, records what played) or auto (null when there's no sound card)")
+	flag.BoolVar(&opts.Debug, "debug", false, "show the debug overlay (toggle with F3)")
+	flag.Int64Var(&opts.Seed, "seed", 0, "random seed for item placement, movement and endless mode maps (0 picks one)")
+	scale := flag.Float64("scale", 1, "window scale (0.25-4)")
+	fullscreen := flag.Bool("fullscreen", false, "start fullscreen")
+	strict := flag.Bool("strict", false, "exit at startup listing every missing asset")
+	assetsDir := flag.String("assets-dir", "", "load assets from this directory (the one containing assets/) instead of the embedded copy and hot-reload PNG/TMX changes")
+	validate := flag.Bool("validate", false, "check every asset, report problems and unused files, then exit")
+	flag.Parse()
+
+	if opts.Level < 1 {
+		log.Fatal("-level must be at least 1")
+	}
+	if opts.Lives < 1 {
+		log.Fatal("-lives must be at least 1")
+	}
+	if !(*scale >= 0.25 && *scale <= 4) { // catches NaN too
+		log.Fatal("-scale must be between 0.25 and 4")
+	}
+	if opts.Audio != "auto" && opts.Audio != "ebiten" && opts.Audio != "null" {
+		log.Fatal("-audio must be auto, ebiten or null")
+	}
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+	rng.Seed(opts.Seed)
+	log.Printf("Random seed %d (replay with -seed %d)", opts.Seed, opts.Seed)
+
+	ebiten.SetWindowSize(int(screenWidth**scale), int(screenHeight**scale))
 	ebiten.SetWindowTitle("Cat's Quest - Project 2 - Jordan DeAndrade")
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeDisabled)
+	ebiten.SetFullscreen(*fullscreen)
 
-	game := NewGame()
-	if err := ebiten.RunGame(game); err != nil {
+	assets := NewAssetManager(assetsFS, *assetsDir)
+	if *validate {
+		os.Exit(runValidate(assets.FS()))
+	}
+	if *strict {
+		preloadAssets(assets)
+		if err := assets.CheckMissing(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	game := NewGame(assets, opts)
+	err := ebiten.RunGame(game)
+	// Counts since the last level end would be lost otherwise
+	game.achievements.Flush()
+	if err != nil {
 		log.Fatal(err)
 	}
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+// updateMenu handles the title screen the game starts on. The first level
+// is already loaded behind it.
+func (g *Game) updateMenu() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEnter) || inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.audioManager.Play("click")
+		g.state = StatePlaying
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+		g.audioManager.Play("click")
+		g.boardRank = -1
+		g.showLeaderboard()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyA) {
+		g.audioManager.Play("click")
+		g.showAchievements()
+	}
+}
+
+func (g *Game) drawMenu(screen *ebiten.Image) {
+	text.Draw(screen, "CAT'S QUEST", basicfont.Face7x13, screenWidth/2-38, 200, color.RGBA{255, 215, 0, 255})
+	text.Draw(screen, "Enter: Play", basicfont.Face7x13, screenWidth/2-38, 260, color.White)
+	text.Draw(screen, "H: High scores", basicfont.Face7x13, screenWidth/2-38, 280, color.White)
+	text.Draw(screen, "A: Achievements", basicfont.Face7x13, screenWidth/2-38, 300, color.White)
+
+	if scores := g.leaderboard.Scores; len(scores) > 0 {
+		best := fmt.Sprintf("Best: %s %d", scores[0].Name, scores[0].Score)
+		text.Draw(screen, best, basicfont.Face7x13, screenWidth/2-len(best)*7/2, 340, color.RGBA{200, 200, 200, 255})
+	}
+}
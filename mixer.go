@@ -0,0 +1,293 @@
+package main
+
+import (
+	"log"
+)
+
+// Bus is a group of sounds sharing a volume
+type Bus int
+
+const (
+	BusMusic Bus = iota
+	BusSFX
+	BusUI
+	busCount
+)
+
+var busNames = [busCount]string{"music", "sfx", "ui"}
+
+// How many sounds can play at once on each bus, and for any one event.
+// When full the oldest voice is cut off.
+var busVoices = [busCount]int{2, 8, 4}
+
+const maxVoicesPerEvent = 3
+
+// Voice is one playing sound. Gain is its own volume before the bus and
+// master volumes are applied.
+type Voice struct {
+	player AudioPlayer
+	stream *panStream // nil for music
+	event  string     // what it was played for, e.g. "eat"
+	sound  string     // which PCM it's playing
+	bus    Bus
+	gain   float64
+}
+
+// pooledPlayer is a finished sound effect player kept for reuse
+type pooledPlayer struct {
+	player AudioPlayer
+	stream *panStream
+}
+
+// Mixer plays sounds on buses. Sound effects are kept as decoded PCM and
+// their players are reused instead of making a new one per sound.
+type Mixer struct {
+	backend AudioBackend
+	master  float64
+	volumes [busCount]float64
+	muted   bool
+
+	sounds  map[string][]byte         // decoded PCM by name
+	voices  []*Voice                  // playing sound effects, oldest first
+	idle    map[string][]pooledPlayer // finished players ready for reuse, by event and sound
+	streams []*Voice                  // long-lived players such as music
+}
+
+func NewMixer(backend AudioBackend) *Mixer {
+	m := &Mixer{
+		backend: backend,
+		master:  1,
+		sounds:  make(map[string][]byte),
+		idle:    make(map[string][]pooledPlayer),
+	}
+	for i := range m.volumes {
+		m.volumes[i] = 1
+	}
+	return m
+}
+
+// Load adds a sound effect as 16-bit stereo PCM at the context's sample rate
+func (m *Mixer) Load(name string, pcm []byte) {
+	m.sounds[name] = pcm
+}
+
+func (m *Mixer) Has(name string) bool {
+	return m.sounds[name] != nil
+}
+
+// Play starts a loaded sound on a bus for an event, panned between -1
+// (left) and 1 (right). Nothing plays if the sound isn't loaded. While
+// muted it still plays, silently, so stingers still duck the music and the
+// recording backend still sees it.
+func (m *Mixer) Play(bus Bus, event, name string, gain, pan float64) *Voice {
+	pcm := m.sounds[name]
+	if pcm == nil {
+		return nil
+	}
+	m.reclaim()
+
+	// Make room by cutting off the oldest voice of this event, then of the bus
+	if m.count(func(v *Voice) bool { return v.event == event }) >= maxVoicesPerEvent {
+		m.stopOldest(func(v *Voice) bool { return v.event == event })
+	}
+	if m.count(func(v *Voice) bool { return v.bus == bus }) >= busVoices[bus] {
+		m.stopOldest(func(v *Voice) bool { return v.bus == bus })
+	}
+
+	var p pooledPlayer
+	key := poolKey(event, name)
+	if idle := m.idle[key]; len(idle) > 0 {
+		p = idle[len(idle)-1]
+		m.idle[key] = idle[:len(idle)-1]
+		if err := p.player.Rewind(); err != nil {
+			log.Printf("Failed to rewind %s: %v", name, err)
+		}
+	} else {
+		p.stream = newPanStream(pcm, false)
+		player, err := m.backend.NewPlayer(event, p.stream)
+		if err != nil {
+			log.Printf("Failed to create player for %s: %v", name, err)
+			return nil
+		}
+		p.player = player
+	}
+	p.stream.SetPan(pan)
+
+	v := &Voice{player: p.player, stream: p.stream, event: event, sound: name, bus: bus, gain: gain}
+	m.apply(v)
+	p.player.Play()
+	m.voices = append(m.voices, v)
+	return v
+}
+
+// Loop plays PCM over and over until the voice is removed with
+// RemoveStream, e.g. a car engine
+func (m *Mixer) Loop(bus Bus, name string, pcm []byte, gain float64) *Voice {
+	stream := newPanStream(pcm, true)
+	player, err := m.backend.NewPlayer(name, stream)
+	if err != nil {
+		log.Printf("Failed to create looping player for %s: %v", name, err)
+		return nil
+	}
+	v := m.AddStream(bus, player, gain)
+	v.stream = stream
+	player.Play()
+	return v
+}
+
+// AddStream puts a long-lived player, e.g. looping music, under the mixer's
+// volume control
+func (m *Mixer) AddStream(bus Bus, player AudioPlayer, gain float64) *Voice {
+	v := &Voice{player: player, bus: bus, gain: gain}
+	m.apply(v)
+	m.streams = append(m.streams, v)
+	return v
+}
+
+// RemoveStream stops a long-lived player for good
+func (m *Mixer) RemoveStream(v *Voice) {
+	for i, s := range m.streams {
+		if s == v {
+			m.streams = append(m.streams[:i], m.streams[i+1:]...)
+			break
+		}
+	}
+	v.player.Pause()
+	if err := v.player.Close(); err != nil {
+		log.Printf("Failed to close player: %v", err)
+	}
+}
+
+// reclaim moves finished voices back to the idle pool
+func (m *Mixer) reclaim() {
+	playing := m.voices[:0]
+	for _, v := range m.voices {
+		if v.player.IsPlaying() {
+			playing = append(playing, v)
+		} else {
+			m.release(v)
+		}
+	}
+	m.voices = playing
+}
+
+// release puts a voice's player back in the pool. The voice can't be used
+// after this.
+func (m *Mixer) release(v *Voice) {
+	key := poolKey(v.event, v.sound)
+	m.idle[key] = append(m.idle[key], pooledPlayer{v.player, v.stream})
+	v.player = nil
+}
+
+// poolKey keeps players apart per event as well as per sound, so a player
+// is always named for the event it plays
+func poolKey(event, sound string) string {
+	return event + " " + sound
+}
+
+func (m *Mixer) count(match func(*Voice) bool) int {
+	n := 0
+	for _, v := range m.voices {
+		if match(v) {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *Mixer) stopOldest(match func(*Voice) bool) {
+	for i, v := range m.voices {
+		if match(v) {
+			v.player.Pause()
+			m.release(v)
+			m.voices = append(m.voices[:i], m.voices[i+1:]...)
+			return
+		}
+	}
+}
+
+// Voices is the number of sound effects playing right now
+func (m *Mixer) Voices() int {
+	m.reclaim()
+	return len(m.voices)
+}
+
+func (m *Mixer) apply(v *Voice) {
+	volume := v.gain * m.volumes[v.bus] * m.master
+	if m.muted {
+		volume = 0
+	}
+	v.player.SetVolume(volume)
+}
+
+func (m *Mixer) applyAll() {
+	for _, v := range m.voices {
+		m.apply(v)
+	}
+	for _, v := range m.streams {
+		m.apply(v)
+	}
+}
+
+func (m *Mixer) Master() float64 {
+	return m.master
+}
+
+func (m *Mixer) SetMaster(volume float64) {
+	m.master = clampVolume(volume)
+	m.applyAll()
+}
+
+func (m *Mixer) Volume(bus Bus) float64 {
+	return m.volumes[bus]
+}
+
+func (m *Mixer) SetVolume(bus Bus, volume float64) {
+	m.volumes[bus] = clampVolume(volume)
+	m.applyAll()
+}
+
+func (m *Mixer) Muted() bool {
+	return m.muted
+}
+
+// SetMuted silences everything. Music keeps its place and carries on when
+// unmuted.
+func (m *Mixer) SetMuted(muted bool) {
+	m.muted = muted
+	m.applyAll()
+}
+
+// SetGain changes a voice's own volume, e.g. for fades
+func (v *Voice) SetGain(m *Mixer, gain float64) {
+	v.gain = gain
+	if v.player != nil {
+		m.apply(v)
+	}
+}
+
+// SetPan moves the sound between the left (-1) and right (1) speakers
+func (v *Voice) SetPan(pan float64) {
+	if v.player != nil && v.stream != nil {
+		v.stream.SetPan(pan)
+	}
+}
+
+// Playing is false once the sound has finished or been cut off
+func (v *Voice) Playing() bool {
+	return v.player != nil && v.player.IsPlaying()
+}
+
+func clampVolume(volume float64) float64 {
+	return max(0, min(volume, 1))
+}
+
+// busByName finds a bus from its name in settings and the console
+func busByName(name string) (Bus, bool) {
+	for i, n := range busNames {
+		if n == name {
+			return Bus(i), true
+		}
+	}
+	return 0, false
+}
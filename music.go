@@ -0,0 +1,137 @@
+package main
+
+import (
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2/audio"
+)
+
+const (
+	crossfadeTicks = 90 // 1.5 seconds between level tracks
+	duckTicks      = 20
+	duckGain       = 0.35 // music volume while ducked
+)
+
+type musicTrack struct {
+	name   string
+	player AudioPlayer
+	voice  *Voice
+	fade   float64 // 0 silent, 1 full
+}
+
+// MusicPlayer plays the level music from the sound manifest. Changing track
+// crossfades, and the music is ducked under stingers, dialogue and the end
+// screens.
+type MusicPlayer struct {
+	am      *AudioManager
+	tracks  map[string]*musicTrack // loaded so far, nil if it failed
+	current *musicTrack
+	ducked  bool
+	duck    float64
+	stinger *Voice
+}
+
+func NewMusicPlayer(am *AudioManager) *MusicPlayer {
+	return &MusicPlayer{am: am, tracks: make(map[string]*musicTrack), duck: 1}
+}
+
+// Play fades over to a track by its manifest name. "" or an unknown name
+// plays the default track.
+func (mp *MusicPlayer) Play(name string) {
+	sounds := mp.am.sounds
+	if sounds.Music[name] == "" {
+		if name != "" {
+			log.Printf("Warning: no music called %q, using %q", name, sounds.DefaultMusic)
+		}
+		name = sounds.DefaultMusic
+	}
+	if name == "" || (mp.current != nil && mp.current.name == name) {
+		return
+	}
+
+	track := mp.load(name, sounds.Music[name])
+	if track == nil {
+		return
+	}
+	if !track.player.IsPlaying() {
+		if err := track.player.Rewind(); err != nil {
+			log.Printf("Failed to rewind music %s: %v", name, err)
+		}
+		track.player.Play()
+	}
+	mp.current = track
+}
+
+// Stop fades the music out
+func (mp *MusicPlayer) Stop() {
+	mp.current = nil
+}
+
+func (mp *MusicPlayer) load(name, file string) *musicTrack {
+	if track, ok := mp.tracks[name]; ok {
+		return track
+	}
+	mp.tracks[name] = nil
+
+	data, err := mp.am.assets.ReadFile(file)
+	if err != nil {
+		log.Printf("Failed to load music: %v", err)
+		return nil
+	}
+	stream, err := decodeStream(file, data)
+	if err != nil {
+		log.Printf("Failed to decode music %s: %v", file, err)
+		return nil
+	}
+	player, err := mp.am.backend.NewPlayer("music "+name, audio.NewInfiniteLoop(stream, stream.Length()))
+	if err != nil {
+		log.Printf("Failed to create music player: %v", err)
+		return nil
+	}
+
+	track := &musicTrack{name: name, player: player, voice: mp.am.mixer.AddStream(BusMusic, player, 0)}
+	mp.tracks[name] = track
+	return track
+}
+
+// SetDucked lowers the music, e.g. while a dialogue is open
+func (mp *MusicPlayer) SetDucked(ducked bool) {
+	mp.ducked = ducked
+}
+
+// Stinger plays a short music cue from the manifest over the ducked music
+func (mp *MusicPlayer) Stinger(event string) {
+	mp.stinger = mp.am.Play(event)
+}
+
+// Update moves the fades along, once per tick
+func (mp *MusicPlayer) Update() {
+	duckTarget := 1.0
+	if mp.ducked || (mp.stinger != nil && mp.stinger.Playing()) {
+		duckTarget = duckGain
+	}
+	mp.duck = approach(mp.duck, duckTarget, (1-duckGain)/duckTicks)
+
+	for _, track := range mp.tracks {
+		if track == nil {
+			continue
+		}
+		target := 0.0
+		if track == mp.current {
+			target = 1
+		}
+		track.fade = approach(track.fade, target, 1.0/crossfadeTicks)
+		if track.fade == 0 && track.player.IsPlaying() {
+			track.player.Pause()
+		}
+		track.voice.SetGain(mp.am.mixer, track.fade*mp.duck)
+	}
+}
+
+// approach moves value towards target by at most step
+func approach(value, target, step float64) float64 {
+	if value < target {
+		return min(value+step, target)
+	}
+	return max(value-step, target)
+}
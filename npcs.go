@@ -1,17 +1,14 @@
 package main
 
 import (
-	"image"
+	"math"
 
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
 type NPC struct {
 	image        *ebiten.Image
-	frames       []*ebiten.Image // Pre-extracted frames for animations
-	currentFrame int
-	frameDelay   int
-	frameCounter int
+	anim         *AnimStateMachine // nil for static NPCs
 	x, y         float64
 	direction    float64
 	moveRange    float64
@@ -21,6 +18,12 @@ type NPC struct {
 	height       int
 	moveHorz     bool
 	scale        float64
+	dialogueID   string        // Conversation shown when the player talks to this NPC
+	portrait     *ebiten.Image // Shown in the dialogue box
+	scaredTimer  int           // Running away from the cat while > 0
+	fleeX, fleeY float64       // Direction to run while scared
+	offsetX      float64       // How far the NPC has run from its patrol path
+	offsetY      float64
 }
 
 func NewStaticNPC(x, y float64, image *ebiten.Image, moveRange float64, moveHorizontal bool) *NPC {
@@ -39,9 +42,10 @@ func NewStaticNPC(x, y float64, image *ebiten.Image, moveRange float64, moveHori
 	}
 }
 
-func NewAnimatedNPC(x, y float64, spriteSheet *ebiten.Image, frameWidth, frameHeight, cols int, moveRange float64, moveHorizontal bool) *NPC {
+// NewAnimatedNPC needs an atlas with "walk" and "flee" clips
+func NewAnimatedNPC(x, y float64, atlas *Atlas, moveRange float64, moveHorizontal bool) *NPC {
 	npc := &NPC{
-		image:     spriteSheet,
+		image:     atlas.Image,
 		x:         x,
 		y:         y,
 		direction: 1,
@@ -54,23 +58,26 @@ func NewAnimatedNPC(x, y float64, spriteSheet *ebiten.Image, frameWidth, frameHe
 		scale:     3.0,
 	}
 
-	npc.frames = make([]*ebiten.Image, cols)
-	for i := 0; i < cols; i++ {
-		x1 := i * frameWidth
-		x2 := x1 + frameWidth
-		y1 := frameHeight
-		y2 := frameHeight * 2
-		npc.frames[i] = spriteSheet.SubImage(image.Rect(x1, y1, x2, y2)).(*ebiten.Image)
-	}
-
-	npc.currentFrame = 0
-	npc.frameDelay = 10
-	npc.frameCounter = 0
+	npc.anim = NewAnimStateMachine()
+	npc.anim.AddState("walk", atlas.MustClip("walk").OnFrame(2, "footstep").OnFrame(6, "footstep"))
+	npc.anim.AddState("flee", atlas.MustClip("flee").OnFrame(2, "footstep").OnFrame(6, "footstep"))
+	npc.anim.AddTransition("walk", "flee", func() bool { return npc.scaredTimer > 0 })
+	npc.anim.AddTransition("flee", "walk", func() bool { return npc.scaredTimer == 0 })
 
 	return npc
 }
 
 func (npc *NPC) Update() {
+	// Run away while scared, then drift back to the patrol path
+	if npc.scaredTimer > 0 {
+		npc.scaredTimer--
+		npc.offsetX += npc.fleeX * 3
+		npc.offsetY += npc.fleeY * 3
+	} else {
+		npc.offsetX *= 0.95
+		npc.offsetY *= 0.95
+	}
+
 	if npc.moveHorz {
 		npc.x += npc.direction
 		if npc.x >= npc.startX+npc.moveRange || npc.x <= npc.startX-npc.moveRange {
@@ -83,23 +90,51 @@ func (npc *NPC) Update() {
 		}
 	}
 
-	if len(npc.frames) > 0 {
-		npc.frameCounter++
-		if npc.frameCounter >= npc.frameDelay {
-			npc.frameCounter = 0
-			npc.currentFrame = (npc.currentFrame + 1) % len(npc.frames)
-		}
+	if npc.anim != nil {
+		npc.anim.Update()
 	}
 }
 
 func (npc *NPC) Draw(target *ebiten.Image, cameraX, cameraY float64) {
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Scale(npc.scale, npc.scale)
-	op.GeoM.Translate(npc.x-cameraX, npc.y-cameraY)
+	op.GeoM.Translate(npc.x+npc.offsetX-cameraX, npc.y+npc.offsetY-cameraY)
 
-	if len(npc.frames) > 0 {
-		target.DrawImage(npc.frames[npc.currentFrame], op)
+	if npc.anim != nil {
+		npc.anim.Draw(target, op, 0)
 	} else {
 		target.DrawImage(npc.image, op)
 	}
 }
+
+// SetDialogue makes the NPC talkable
+func (npc *NPC) SetDialogue(id string, portrait *ebiten.Image) {
+	npc.dialogueID = id
+	npc.portrait = portrait
+}
+
+// Center returns the middle of the NPC as drawn
+func (npc *NPC) Center() (float64, float64) {
+	w, h := float64(npc.width), float64(npc.height)
+	if npc.anim != nil {
+		fw, fh := npc.anim.FrameSize()
+		w, h = float64(fw)*npc.scale, float64(fh)*npc.scale
+	} else if npc.image != nil {
+		b := npc.image.Bounds()
+		w, h = float64(b.Dx())*npc.scale, float64(b.Dy())*npc.scale
+	}
+	return npc.x + npc.offsetX + w/2, npc.y + npc.offsetY + h/2
+}
+
+// Scare makes the NPC run away from (fromX, fromY) for a moment
+func (npc *NPC) Scare(fromX, fromY float64) {
+	cx, cy := npc.Center()
+	dx, dy := cx-fromX, cy-fromY
+	dist := math.Hypot(dx, dy)
+	if dist == 0 {
+		dx, dy, dist = 1, 0, 1
+	}
+	npc.fleeX = dx / dist
+	npc.fleeY = dy / dist
+	npc.scaredTimer = 30
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+const pcmFrameSize = 4 // 16-bit stereo
+
+// panStream plays 16-bit stereo PCM from memory with a left/right balance,
+// optionally looping. The audio player reads it from its own goroutine, so
+// everything is behind a lock.
+type panStream struct {
+	mu          sync.Mutex
+	pcm         []byte
+	pos         int64
+	loop        bool
+	left, right float64
+}
+
+func newPanStream(pcm []byte, loop bool) *panStream {
+	return &panStream{pcm: pcm, loop: loop, left: 1, right: 1}
+}
+
+// SetPan sets the balance from -1 (left only) through 0 (both) to 1 (right
+// only)
+func (s *panStream) SetPan(pan float64) {
+	pan = max(-1, min(pan, 1))
+	s.mu.Lock()
+	s.left = min(1, 1-pan)
+	s.right = min(1, 1+pan)
+	s.mu.Unlock()
+}
+
+func (s *panStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for n+pcmFrameSize <= len(p) {
+		if s.pos+pcmFrameSize > int64(len(s.pcm)) {
+			if !s.loop || len(s.pcm) < pcmFrameSize {
+				break
+			}
+			s.pos = 0
+		}
+		l := float64(int16(binary.LittleEndian.Uint16(s.pcm[s.pos:])))
+		r := float64(int16(binary.LittleEndian.Uint16(s.pcm[s.pos+2:])))
+		binary.LittleEndian.PutUint16(p[n:], uint16(int16(l*s.left)))
+		binary.LittleEndian.PutUint16(p[n+2:], uint16(int16(r*s.right)))
+		n += pcmFrameSize
+		s.pos += pcmFrameSize
+	}
+	if n == 0 && len(p) >= pcmFrameSize {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *panStream) Seek(offset int64, whence int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += int64(len(s.pcm))
+	default:
+		return 0, errors.New("panStream: bad whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("panStream: negative position")
+	}
+	s.pos = min(offset/pcmFrameSize*pcmFrameSize, int64(len(s.pcm)))
+	return s.pos, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"log"
+	"math"
+	"slices"
+)
+
+const placementTries = 300
+
+// itemPlacer scatters items over the level following the registry's
+// placement rules. Tiles are checked with their "terrain" property, and
+// items are only put where the cat can get to from its start without going
+// through a solid tile.
+type itemPlacer struct {
+	g                     *Game
+	rules                 ItemPlacement
+	tileWidth, tileHeight int
+	cols, rows            int
+	reachable             []bool // by tile
+	placed                [][2]float64
+}
+
+func (g *Game) newItemPlacer() *itemPlacer {
+	p := &itemPlacer{g: g, rules: g.itemRegistry.Placement}
+	p.tileWidth, p.tileHeight = g.tileMap.TileSize()
+	p.cols = g.tileMap.Width() / p.tileWidth
+	p.rows = g.tileMap.Height() / p.tileHeight
+	p.findReachable()
+	// Keep clear of what's already on the level
+	for _, item := range g.items {
+		if !item.collected {
+			p.placed = append(p.placed, [2]float64{item.x + float64(item.width)/2, item.y + float64(item.height)/2})
+		}
+	}
+	return p
+}
+
+// findReachable walks the map breadth-first from the tile under the cat
+func (p *itemPlacer) findReachable() {
+	p.reachable = make([]bool, p.cols*p.rows)
+	startX, startY := p.tileAt(p.g.player.x+float64(p.g.player.width)/2, p.g.player.y+float64(p.g.player.height)/2)
+	if !p.inside(startX, startY) {
+		return
+	}
+
+	p.reachable[startY*p.cols+startX] = true
+	queue := [][2]int{{startX, startY}}
+	for len(queue) > 0 {
+		x, y := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			nx, ny := x+d[0], y+d[1]
+			if !p.inside(nx, ny) || p.reachable[ny*p.cols+nx] || p.g.tileMap.Solid(nx, ny) {
+				continue
+			}
+			p.reachable[ny*p.cols+nx] = true
+			queue = append(queue, [2]int{nx, ny})
+		}
+	}
+}
+
+func (p *itemPlacer) tileAt(x, y float64) (int, int) {
+	return int(x) / p.tileWidth, int(y) / p.tileHeight
+}
+
+func (p *itemPlacer) inside(tileX, tileY int) bool {
+	return tileX >= 0 && tileY >= 0 && tileX < p.cols && tileY < p.rows
+}
+
+// Place adds an item of the species at a random spot that passes the rules.
+// Spacing is halved if no spot is found in the first half of the tries and
+// dropped for the last quarter. Returns nil if there's still no room; the
+// caller reports how many didn't fit.
+func (p *itemPlacer) Place(species *ItemSpecies) *Item {
+	mapWidth, mapHeight := p.g.tileMap.Width(), p.g.tileMap.Height()
+	item := NewSpeciesItem(0, 0, species)
+	for try := 0; try < placementTries; try++ {
+		item.x = float64(rng.Intn(mapWidth-100) + 50)
+		item.y = float64(rng.Intn(mapHeight-100) + 50)
+
+		spacing := p.rules.Spacing
+		if try >= placementTries*3/4 {
+			spacing = 0
+		} else if try >= placementTries/2 {
+			spacing /= 2
+		}
+		cx, cy := item.x+float64(item.width)/2, item.y+float64(item.height)/2
+		if p.fits(cx, cy, species, spacing) {
+			p.placed = append(p.placed, [2]float64{cx, cy})
+			return item
+		}
+	}
+	return nil
+}
+
+// nearCarPath is true within CarRadius of where a car will drive: its whole
+// lane for a car kept to a road. Roaming cars can go anywhere, so only
+// where they start is kept clear.
+func (p *itemPlacer) nearCarPath(car *Car, cx, cy float64) bool {
+	carX, carY := car.x+float64(car.width)/2, car.y+float64(car.height)/2
+	switch car.lane {
+	case LaneHorizontal:
+		return math.Abs(cy-carY) < p.rules.CarRadius
+	case LaneVertical:
+		return math.Abs(cx-carX) < p.rules.CarRadius
+	}
+	return math.Hypot(cx-carX, cy-carY) < p.rules.CarRadius
+}
+
+func (p *itemPlacer) fits(cx, cy float64, species *ItemSpecies, spacing float64) bool {
+	tileX, tileY := p.tileAt(cx, cy)
+	if !p.inside(tileX, tileY) || !p.reachable[tileY*p.cols+tileX] {
+		return false
+	}
+
+	// Untagged tiles are fine for everything
+	if terrain := p.g.tileMap.TileProperty(tileX, tileY, "terrain"); terrain != "" {
+		if slices.Contains(p.rules.AvoidTerrain, terrain) {
+			return false
+		}
+		if len(species.Terrain) > 0 && !slices.Contains(species.Terrain, terrain) {
+			return false
+		}
+	}
+
+	player, portal := p.g.player, p.g.portal
+	if math.Hypot(cx-player.x-float64(player.width)/2, cy-player.y-float64(player.height)/2) < p.rules.StartRadius {
+		return false
+	}
+	if math.Hypot(cx-portal.x-float64(portal.width)/2, cy-portal.y-float64(portal.height)/2) < p.rules.PortalRadius {
+		return false
+	}
+	for _, car := range p.g.cars {
+		if p.nearCarPath(car, cx, cy) {
+			return false
+		}
+	}
+	for _, other := range p.placed {
+		if math.Hypot(cx-other[0], cy-other[1]) < spacing {
+			return false
+		}
+	}
+	return true
+}
+
+// topUpFish puts more fish down when too few are left on the level to finish
+// the objective, e.g. after some despawned, so it can always be done
+func (g *Game) topUpFish() {
+	need, name := g.quests.FishNeeded(g)
+	for _, item := range g.items {
+		if !item.collected && item.itemType == ItemGood && (name == "" || item.SpeciesName() == name) {
+			need--
+		}
+	}
+	if need <= 0 {
+		return
+	}
+
+	placer := g.newItemPlacer()
+	for ; need > 0; need-- {
+		species := g.itemRegistry.PickGood()
+		if name != "" {
+			species = g.itemRegistry.Get(name)
+		}
+		if species == nil {
+			return
+		}
+		item := placer.Place(species)
+		if item == nil {
+			if !g.noRoomForFish {
+				log.Printf("Warning: no room for more fish on %s, the objective may not be finished", g.levelPath)
+				g.noRoomForFish = true
+			}
+			return
+		}
+		g.items = append(g.items, item)
+	}
+}
+
+// keepOutOfWalls stops the cat walking into solid tiles. Each direction is
+// tried on its own first, so it slides along a wall instead of sticking.
+func (g *Game) keepOutOfWalls(prevX, prevY float64) {
+	p := g.player
+	inWall := func() bool {
+		x, y, w, h := p.GetBounds()
+		return g.tileMap.SolidIn(x, y, w, h)
+	}
+	if !inWall() {
+		return
+	}
+	x, y := p.x, p.y
+	for _, try := range [][2]float64{{prevX, y}, {x, prevY}, {prevX, prevY}} {
+		p.x, p.y = try[0], try[1]
+		if !inWall() {
+			return
+		}
+	}
+	// Already in a wall, e.g. started in one; let it walk out
+	p.x, p.y = x, y
+}
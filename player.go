@@ -2,19 +2,40 @@ package main
 
 import (
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
+const (
+	lungeSpeed     = 7.0 // pixels per tick while lunging
+	pounceCooldown = 45  // ticks after a pounce ends before the next one
+	swipeReach     = 36.0
+)
+
+// directionVectors maps Player.direction to a unit-ish step, matching the
+// order of the walk_N/attack_N sheets
+var directionVectors = [8][2]float64{
+	{-0.707, -0.707}, {0, -1}, {0.707, -0.707}, {1, 0},
+	{0.707, 0.707}, {0, 1}, {-0.707, 0.707}, {-1, 0},
+}
+
 type Player struct {
-	walkSprites [8]*AnimatedSprite
+	anim        *AnimStateMachine
 	x, y        float64
 	width       int
 	height      int
 	direction   int
 	isMoving    bool
 	speed       float64
+	statuses    []*StatusEffect
+	flashTimer  int
+	pounceTimer int // ticks left in the current pounce
+	pounceTicks int // length of the attack clip; the first half lunges
+	cooldown    int // ticks until the cat can pounce again
 }
 
-func NewPlayer(x, y float64, walkSprites [8]*ebiten.Image) *Player {
+// NewPlayer takes one walk and one attack atlas per direction, in the order
+// of directionVectors
+func NewPlayer(x, y float64, walkAtlases, attackAtlases []*Atlas) *Player {
 	p := &Player{
 		x:         x,
 		y:         y,
@@ -24,15 +45,49 @@ func NewPlayer(x, y float64, walkSprites [8]*ebiten.Image) *Player {
 		speed:     3.0,
 	}
 
-	for i := 0; i < 8; i++ {
-		p.walkSprites[i] = NewAnimatedSprite(walkSprites[i], 64, 64)
-	}
+	attack := MustDirectionalClip(attackAtlases, "attack").OnFrame(1, "swipe")
+	p.pounceTicks = attack.TotalTicks()
+
+	p.anim = NewAnimStateMachine()
+	p.anim.AddState("idle", MustDirectionalClip(walkAtlases, "idle"))
+	p.anim.AddState("walk", MustDirectionalClip(walkAtlases, "walk").OnFrame(2, "footstep").OnFrame(6, "footstep"))
+	p.anim.AddState("run", MustDirectionalClip(walkAtlases, "run").OnFrame(2, "footstep").OnFrame(6, "footstep"))
+	p.anim.AddState("attack", attack)
+	p.anim.AddState("hurt", MustDirectionalClip(walkAtlases, "hurt").WithTint(1, 0.4, 0.4))
+
+	moving := func() bool { return p.isMoving }
+	running := func() bool { return p.isMoving && p.HasStatus(StatusSpeed) }
+	walking := func() bool { return p.isMoving && !p.HasStatus(StatusSpeed) }
+	stopped := func() bool { return !p.isMoving }
+	done := p.anim.Finished
+
+	p.anim.AddTransition("attack", "idle", done)
+	p.anim.AddTransition("hurt", "idle", done)
+	p.anim.AddTransition("idle", "run", running)
+	p.anim.AddTransition("idle", "walk", moving)
+	p.anim.AddTransition("walk", "run", running)
+	p.anim.AddTransition("run", "walk", walking)
+	p.anim.AddTransition("walk", "idle", stopped)
+	p.anim.AddTransition("run", "idle", stopped)
 
 	return p
 }
 
 func (p *Player) Update(mapWidth, mapHeight int) {
 	p.isMoving = false
+	p.updateStatuses()
+	p.flashTimer++
+
+	if p.cooldown > 0 {
+		p.cooldown--
+	}
+	if p.pounceTimer == 0 && p.cooldown == 0 && inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		p.startPounce()
+	}
+	if p.pounceTimer > 0 {
+		p.updatePounce(mapWidth, mapHeight)
+		return
+	}
 
 	moveX := 0.0
 	moveY := 0.0
@@ -75,10 +130,15 @@ func (p *Player) Update(mapWidth, mapHeight int) {
 			moveY *= 0.707
 		}
 
-		p.x += moveX * p.speed
-		p.y += moveY * p.speed
+		p.x += moveX * p.Speed()
+		p.y += moveY * p.Speed()
 	}
 
+	p.clampToMap(mapWidth, mapHeight)
+	p.anim.Update()
+}
+
+func (p *Player) clampToMap(mapWidth, mapHeight int) {
 	if p.x < 0 {
 		p.x = 0
 	}
@@ -91,18 +151,56 @@ func (p *Player) Update(mapWidth, mapHeight int) {
 	if p.y+float64(p.height) > float64(mapHeight) {
 		p.y = float64(mapHeight - p.height)
 	}
+}
 
-	if p.isMoving {
-		p.walkSprites[p.direction].Update()
-	} else {
-		p.walkSprites[p.direction].currentFrame = 0
+func (p *Player) startPounce() {
+	p.pounceTimer = p.pounceTicks
+	p.anim.Play("attack")
+}
+
+// Hurt plays the hurt animation, e.g. when a life is lost
+func (p *Player) Hurt() {
+	p.pounceTimer = 0
+	p.anim.Play("hurt")
+}
+
+// updatePounce lunges the cat forward and plays the swipe once
+func (p *Player) updatePounce(mapWidth, mapHeight int) {
+	if p.pounceTimer > p.pounceTicks/2 {
+		dir := directionVectors[p.direction]
+		p.x += dir[0] * lungeSpeed
+		p.y += dir[1] * lungeSpeed
+		p.clampToMap(mapWidth, mapHeight)
+	}
+
+	p.anim.Update()
+
+	p.pounceTimer--
+	if p.pounceTimer == 0 {
+		p.cooldown = pounceCooldown
 	}
 }
 
+func (p *Player) IsPouncing() bool {
+	return p.pounceTimer > 0
+}
+
+// SwipeBounds is the area in front of the cat hit by a pounce
+func (p *Player) SwipeBounds() (float64, float64, float64, float64) {
+	x, y, w, h := p.GetBounds()
+	dir := directionVectors[p.direction]
+	return x + dir[0]*swipeReach - 8, y + dir[1]*swipeReach - 8, w + 16, h + 16
+}
+
 func (p *Player) Draw(target *ebiten.Image, cameraX, cameraY float64) {
+	// Flash while invincible
+	if p.HasStatus(StatusInvincible) && (p.flashTimer/6)%2 == 0 {
+		return
+	}
+
 	op := &ebiten.DrawImageOptions{}
 	op.GeoM.Translate(p.x-cameraX, p.y-cameraY)
-	p.walkSprites[p.direction].Draw(target, op)
+	p.anim.Draw(target, op, p.direction)
 }
 
 func (p *Player) GetBounds() (float64, float64, float64, float64) {
@@ -0,0 +1,47 @@
+package main
+
+import "math"
+
+const scareRadius = 110.0
+
+// resolvePounce lets the cat's swipe knock hazards away and scare NPCs. It
+// runs on the "swipe" frame of the attack animation; fish caught by the
+// swipe are picked up in the normal collision loop for the whole pounce.
+func (g *Game) resolvePounce() {
+	if !g.player.IsPouncing() {
+		return
+	}
+
+	sx, sy, sw, sh := g.player.SwipeBounds()
+	cx := sx + sw/2
+	cy := sy + sh/2
+
+	for _, item := range g.items {
+		if item.itemType != ItemBad || item.knockTimer > 0 || !item.CheckCollision(sx, sy, sw, sh) {
+			continue
+		}
+		dx := item.x + float64(item.width)/2 - cx
+		dy := item.y + float64(item.height)/2 - cy
+		dist := math.Hypot(dx, dy)
+		if dist == 0 {
+			dir := directionVectors[g.player.direction]
+			dx, dy, dist = dir[0], dir[1], 1
+		}
+		item.Knock(dx/dist, dy/dist)
+	}
+
+	for _, npc := range g.npcs {
+		nx, ny := npc.Center()
+		if math.Hypot(nx-cx, ny-cy) < scareRadius {
+			npc.Scare(cx, cy)
+		}
+	}
+}
+
+// caughtBySwipe reports whether a pounce grabs this item
+func (g *Game) caughtBySwipe(item *Item) bool {
+	if !g.player.IsPouncing() || item.itemType == ItemBad {
+		return false
+	}
+	return item.CheckCollision(g.player.SwipeBounds())
+}
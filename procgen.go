@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path"
+)
+
+// Generated levels use the 64px terrain tiles next to level2.tmx. The TMX is
+// given a path in that folder so the image sources resolve.
+const generatedMapDir = "assets/background"
+
+// genTerrain is one terrain type. Weight is how likely a region is to be
+// this terrain; roads and sidewalks are laid separately.
+type genTerrain struct {
+	Name   string
+	Image  string
+	Weight int
+}
+
+var genTerrains = []genTerrain{
+	{"grass", "grass_01_tile_64_01.png", 50},
+	{"sand", "sand_01_tile_64_01.png", 20},
+	{"clay", "clay_tile_64_01.png", 15},
+	{"ice", "ice_tile_64_01.png", 15},
+	{"road", "paving_01_tile_64_02.png", 0},
+	{"sidewalk", "paving_02_tile_64_01.png", 0},
+}
+
+// Music names from sounds.json that generated levels pick from
+var genMusic = []string{"meadow", "town", "night"}
+
+const (
+	terrainRoad     = 4 // index into genTerrains
+	terrainSidewalk = 5
+	genTileSize     = 64
+)
+
+// LevelGenerator builds a level from a seed. The same seed and level always
+// give the same map.
+type LevelGenerator struct {
+	rng           *rand.Rand
+	width, height int   // in tiles
+	tiles         []int // index into genTerrains
+}
+
+// GenerateLevel makes an endless mode level. Levels get bigger and busier
+// the further in they are.
+func GenerateLevel(seed int64, level int) (*tmxMap, error) {
+	depth := level - len(levelMaps) + 1 // 1 for the first generated level
+	size := 20 + min(depth-1, 10)
+	gen := &LevelGenerator{
+		rng:    rand.New(rand.NewSource(seed*1000003 + int64(level))),
+		width:  size,
+		height: size,
+		tiles:  make([]int, size*size),
+	}
+
+	gen.paintRegions()
+	gen.smooth()
+	gen.smooth()
+	roads := gen.layRoads(1 + depth/3)
+
+	// Roads start at row/column 3, so the start corner is always clear
+	startX, startY := 1, 1
+	dist := gen.distances(startX, startY)
+	portalX, portalY, ok := gen.farthest(dist)
+	if !ok {
+		return nil, fmt.Errorf("generated level %d: portal can't be reached", level)
+	}
+
+	objects := []MapObject{
+		{Kind: "player", X: float64(startX*genTileSize + 16), Y: float64(startY*genTileSize + 16)},
+		{Kind: "portal", X: float64(portalX * genTileSize), Y: float64(portalY * genTileSize)},
+	}
+	objects = append(objects, gen.cars(roads, min(depth, 6), math.Min(2+0.25*float64(depth), 4))...)
+	objects = append(objects, gen.npcs(2+min(depth, 4), dist)...)
+
+	m := newTMXMap(gen.width, gen.height, genTileSize, genTileSize)
+	m.Properties = m.Properties.add("music", "", genMusic[gen.rng.Intn(len(genMusic))])
+	ts := tmxTileset{FirstGID: 1, Name: "terrain", TileWidth: genTileSize, TileHeight: genTileSize, TileCount: len(genTerrains)}
+	for i, t := range genTerrains {
+		ts.Tiles = append(ts.Tiles, tmxTile{
+			ID:         uint32(i),
+			Properties: (*tmxProperties)(nil).add("terrain", "", t.Name),
+			Image:      &tmxImage{Source: t.Image, Width: genTileSize, Height: genTileSize},
+		})
+	}
+	m.Tilesets = []tmxTileset{ts}
+
+	gids := make([]uint32, len(gen.tiles))
+	for i, t := range gen.tiles {
+		gids[i] = uint32(t) + 1
+	}
+	m.AddLayer("Terrain", gids)
+	m.AddObjects("entities", objects)
+	return m, nil
+}
+
+// paintRegions splits the map into blobs of terrain around random points
+func (gen *LevelGenerator) paintRegions() {
+	type site struct {
+		x, y    float64
+		terrain int
+	}
+	sites := make([]site, gen.width*gen.height/40)
+	for i := range sites {
+		sites[i] = site{
+			x:       gen.rng.Float64() * float64(gen.width),
+			y:       gen.rng.Float64() * float64(gen.height),
+			terrain: gen.pickTerrain(),
+		}
+	}
+	// The start corner is grass
+	sites[0] = site{x: 1, y: 1, terrain: 0}
+
+	for y := 0; y < gen.height; y++ {
+		for x := 0; x < gen.width; x++ {
+			best := math.MaxFloat64
+			for _, s := range sites {
+				// Jitter makes the borders ragged instead of straight lines
+				d := math.Hypot(float64(x)-s.x, float64(y)-s.y) + gen.rng.Float64()*1.5
+				if d < best {
+					best = d
+					gen.tiles[y*gen.width+x] = s.terrain
+				}
+			}
+		}
+	}
+}
+
+func (gen *LevelGenerator) pickTerrain() int {
+	total := 0
+	for _, t := range genTerrains {
+		total += t.Weight
+	}
+	n := gen.rng.Intn(total)
+	for i, t := range genTerrains {
+		if n < t.Weight {
+			return i
+		}
+		n -= t.Weight
+	}
+	return 0
+}
+
+// smooth gives each tile the terrain most of its neighbours have, which
+// removes lone tiles left by the jitter
+func (gen *LevelGenerator) smooth() {
+	out := make([]int, len(gen.tiles))
+	for y := 0; y < gen.height; y++ {
+		for x := 0; x < gen.width; x++ {
+			counts := make(map[int]int)
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if gen.inside(x+dx, y+dy) {
+						counts[gen.tiles[(y+dy)*gen.width+x+dx]]++
+					}
+				}
+			}
+			out[y*gen.width+x] = gen.tiles[y*gen.width+x]
+			for t, n := range counts {
+				if n >= 5 {
+					out[y*gen.width+x] = t
+				}
+			}
+		}
+	}
+	gen.tiles = out
+}
+
+// genRoad is a straight two-tile-wide road across the map
+type genRoad struct {
+	horizontal bool
+	at         int // first row or column
+}
+
+// layRoads adds crossing roads with sidewalks, away from the start corner
+func (gen *LevelGenerator) layRoads(count int) []genRoad {
+	var roads []genRoad
+	for i := 0; i < count; i++ {
+		horizontal := i%2 == 0
+		span := gen.height
+		if !horizontal {
+			span = gen.width
+		}
+		road := genRoad{horizontal: horizontal, at: 4 + gen.rng.Intn(span-8)}
+		roads = append(roads, road)
+
+		for n := 0; n < span; n++ {
+			for w := -1; w <= 2; w++ {
+				x, y := n, road.at+w
+				if !horizontal {
+					x, y = road.at+w, n
+				}
+				if !gen.inside(x, y) {
+					continue
+				}
+				i := y*gen.width + x
+				if w == 0 || w == 1 {
+					gen.tiles[i] = terrainRoad
+				} else if gen.tiles[i] != terrainRoad {
+					gen.tiles[i] = terrainSidewalk
+				}
+			}
+		}
+	}
+	return roads
+}
+
+func (gen *LevelGenerator) inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < gen.width && y < gen.height
+}
+
+// distances is a breadth-first walk from the start, -1 for tiles the cat
+// can't reach. Every terrain is walkable today, but a blocking terrain would
+// only need to be skipped here.
+func (gen *LevelGenerator) distances(startX, startY int) []int {
+	dist := make([]int, len(gen.tiles))
+	for i := range dist {
+		dist[i] = -1
+	}
+	dist[startY*gen.width+startX] = 0
+	queue := [][2]int{{startX, startY}}
+	for len(queue) > 0 {
+		x, y := queue[0][0], queue[0][1]
+		queue = queue[1:]
+		for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+			nx, ny := x+d[0], y+d[1]
+			if !gen.inside(nx, ny) || dist[ny*gen.width+nx] >= 0 {
+				continue
+			}
+			dist[ny*gen.width+nx] = dist[y*gen.width+x] + 1
+			queue = append(queue, [2]int{nx, ny})
+		}
+	}
+	return dist
+}
+
+// farthest is the reachable off-road tile furthest from the start, kept
+// one tile in from the edge
+func (gen *LevelGenerator) farthest(dist []int) (int, int, bool) {
+	bestX, bestY, best := 0, 0, -1
+	for y := 1; y < gen.height-1; y++ {
+		for x := 1; x < gen.width-1; x++ {
+			i := y*gen.width + x
+			if dist[i] > best && gen.tiles[i] < terrainRoad {
+				bestX, bestY, best = x, y, dist[i]
+			}
+		}
+	}
+	return bestX, bestY, best > 0
+}
+
+// cars puts cars on the roads, kept to them by their road property
+func (gen *LevelGenerator) cars(roads []genRoad, count int, speed float64) []MapObject {
+	sprites := carSpriteNames()
+	var cars []MapObject
+	for i := 0; i < count; i++ {
+		road := roads[i%len(roads)]
+		span := gen.width
+		if !road.horizontal {
+			span = gen.height
+		}
+		n := 2 + gen.rng.Intn(span-4)
+		// Centered on the middle of the two road tiles
+		x, y := n*genTileSize, (road.at+1)*genTileSize
+		if !road.horizontal {
+			x, y = (road.at+1)*genTileSize, n*genTileSize
+		}
+		lane := LaneVertical
+		if road.horizontal {
+			lane = LaneHorizontal
+		}
+		cars = append(cars, MapObject{Kind: "car", X: float64(x - 40), Y: float64(y - 40), Props: map[string]string{
+			"sprite": sprites[i%len(sprites)],
+			"speed":  fmt.Sprintf("%.2f", speed),
+			"road":   lane,
+		}})
+	}
+	return cars
+}
+
+// npcs places walkers on reachable off-road tiles with patrols that stay on
+// the map. The first one can be talked to.
+func (gen *LevelGenerator) npcs(count int, dist []int) []MapObject {
+	var npcs []MapObject
+	for tries := 0; len(npcs) < count && tries < 200; tries++ {
+		x, y := 2+gen.rng.Intn(gen.width-4), 2+gen.rng.Intn(gen.height-4)
+		i := y*gen.width + x
+		if dist[i] < 3 || gen.tiles[i] >= terrainRoad {
+			continue
+		}
+
+		horizontal := gen.rng.Intn(2) == 0
+		room := float64(min(x, gen.width-1-x)) * genTileSize
+		if !horizontal {
+			room = float64(min(y, gen.height-1-y)) * genTileSize
+		}
+		moveRange := math.Min(80+float64(gen.rng.Intn(81)), room)
+
+		npc := MapObject{Kind: "npc", X: float64(x * genTileSize), Y: float64(y * genTileSize), Props: map[string]string{
+			"range":      fmt.Sprintf("%.0f", moveRange),
+			"horizontal": fmt.Sprint(horizontal),
+		}}
+		if len(npcs) == 0 {
+			npc.Props["dialogue"] = "walker"
+		}
+		npcs = append(npcs, npc)
+	}
+	return npcs
+}
+
+// generateLevel builds endless mode level n from the game's seed
+func (g *Game) generateLevel(level int) (string, *TileMap, error) {
+	m, err := GenerateLevel(g.options.Seed, level)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := m.Encode()
+	if err != nil {
+		return "", nil, err
+	}
+	name := path.Join(generatedMapDir, fmt.Sprintf("generated_%d.tmx", level))
+	tileMap, err := g.assets.TileMapData(name, data)
+	return name, tileMap, err
+}
+
+// startEndless carries on after level 3 with generated levels
+func (g *Game) startEndless() {
+	g.state = StatePlaying
+	g.currentLevel = len(levelMaps)
+	g.itemsCollected = 0
+	g.loadLevel(g.currentLevel)
+}
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const questsFile = "assets/data/quests.json"
+
+// Objective kinds
+const (
+	ObjectiveCollect   = "collect"   // pick up Count fish (of Species, if set)
+	ObjectiveDeliver   = "deliver"   // talk to NPC while carrying Count fish
+	ObjectiveAvoidCars = "avoidCars" // don't get hit by a car for Seconds
+	ObjectiveReach     = "reach"     // walk within Radius of X,Y
+)
+
+type QuestObjective struct {
+	Kind    string  `json:"kind"`
+	Text    string  `json:"text"`
+	Species string  `json:"species,omitempty"`
+	Count   int     `json:"count,omitempty"`
+	NPC     string  `json:"npc,omitempty"` // dialogue id of the NPC to deliver to
+	Seconds int     `json:"seconds,omitempty"`
+	X       float64 `json:"x,omitempty"`
+	Y       float64 `json:"y,omitempty"`
+	Radius  float64 `json:"radius,omitempty"`
+}
+
+// target is the progress value at which the objective is done
+func (o *QuestObjective) target() int {
+	switch o.Kind {
+	case ObjectiveAvoidCars:
+		return o.Seconds * ebiten.DefaultTPS
+	case ObjectiveReach, ObjectiveDeliver:
+		return 1
+	}
+	return o.Count
+}
+
+// QuestDef is a quest as written in the data file. Quests with a Level are
+// handed out automatically when that level starts and dropped when it ends;
+// quests without one must be given by a dialogue effect.
+//
+// An Objective quest is a level's goal instead: the portal opens once it's
+// done. It's handed out fresh on every level, the one for the level if there
+// is one, otherwise the one without a Level.
+type QuestDef struct {
+	ID          string           `json:"id"`
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Level       int              `json:"level,omitempty"`
+	Objective   bool             `json:"objective,omitempty"`
+	Objectives  []QuestObjective `json:"objectives"`
+	Reward      *Effect          `json:"reward,omitempty"`
+}
+
+type Quest struct {
+	def      *QuestDef
+	progress []int // one entry per objective
+}
+
+func (q *Quest) objectiveDone(i int) bool {
+	return q.progress[i] >= q.def.Objectives[i].target()
+}
+
+func (q *Quest) done() bool {
+	for i := range q.def.Objectives {
+		if !q.objectiveDone(i) {
+			return false
+		}
+	}
+	return true
+}
+
+type QuestLog struct {
+	defs      map[string]*QuestDef
+	active    []*Quest
+	completed map[string]bool
+	objective string // id of this level's objective quest
+	open      bool   // quest log window is showing
+}
+
+func NewQuestLog(fsys fs.FS, file string) *QuestLog {
+	ql := &QuestLog{
+		defs:      make(map[string]*QuestDef),
+		completed: make(map[string]bool),
+	}
+
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		log.Printf("Warning: Failed to load quests %s: %v", file, err)
+		return ql
+	}
+
+	var defs []*QuestDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		log.Printf("Warning: Failed to parse quests %s: %v", file, err)
+		return ql
+	}
+	for _, d := range defs {
+		ql.defs[d.ID] = d
+	}
+
+	return ql
+}
+
+// Reset forgets all quest progress, used when restarting the game
+func (ql *QuestLog) Reset() {
+	ql.active = nil
+	ql.completed = make(map[string]bool)
+}
+
+func (ql *QuestLog) IsActive(id string) bool {
+	for _, q := range ql.active {
+		if q.def.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (ql *QuestLog) IsCompleted(id string) bool {
+	return ql.completed[id]
+}
+
+// Assign starts a quest unless it's already running or finished
+func (ql *QuestLog) Assign(id string) {
+	def := ql.defs[id]
+	if def == nil {
+		log.Printf("Warning: unknown quest %q", id)
+		return
+	}
+	if ql.IsActive(id) || ql.completed[id] {
+		return
+	}
+
+	ql.active = append(ql.active, &Quest{def: def, progress: make([]int, len(def.Objectives))})
+}
+
+// OnLevelStart drops unfinished quests from other levels and hands out the
+// quests that belong to this one, objective first
+func (ql *QuestLog) OnLevelStart(level int) {
+	kept := ql.active[:0]
+	for _, q := range ql.active {
+		if !q.def.Objective && (q.def.Level == 0 || q.def.Level == level) {
+			kept = append(kept, q)
+		}
+	}
+	ql.active = kept
+
+	ql.objective = ql.objectiveFor(level)
+	if ql.objective == "" {
+		log.Printf("Warning: no objective quest for level %d, the portal starts open", level)
+	}
+	ql.RestartObjective()
+
+	var ids []string
+	for id, def := range ql.defs {
+		if def.Level == level && !def.Objective {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ql.Assign(id)
+	}
+}
+
+// RestartObjective hands out the level's objective again from the start,
+// e.g. when the level is played again after editing it
+func (ql *QuestLog) RestartObjective() {
+	if ql.objective == "" {
+		return
+	}
+	ql.active = slices.DeleteFunc(ql.active, func(q *Quest) bool { return q.def.ID == ql.objective })
+	delete(ql.completed, ql.objective)
+	ql.Assign(ql.objective)
+}
+
+// objectiveFor picks a level's objective quest: one written for the level,
+// or else one for any level. Ties go to the first id.
+func (ql *QuestLog) objectiveFor(level int) string {
+	best := ""
+	for id, def := range ql.defs {
+		if !def.Objective || (def.Level != 0 && def.Level != level) {
+			continue
+		}
+		if best == "" {
+			best = id
+			continue
+		}
+		other := ql.defs[best]
+		if (def.Level == level && other.Level == 0) || (def.Level == other.Level && id < best) {
+			best = id
+		}
+	}
+	return best
+}
+
+// ObjectiveDone is whether the level's objective is finished, so the portal
+// can open
+func (ql *QuestLog) ObjectiveDone() bool {
+	return ql.objective == "" || ql.completed[ql.objective]
+}
+
+// ObjectiveText is the objective's next step and progress for the HUD, e.g.
+// "Eat fish 3/9", or "" once it's done
+func (ql *QuestLog) ObjectiveText() string {
+	for _, q := range ql.active {
+		if q.def.ID != ql.objective {
+			continue
+		}
+		for i, o := range q.def.Objectives {
+			if !q.objectiveDone(i) {
+				return strings.TrimSpace(o.Text + " " + q.progressText(i))
+			}
+		}
+	}
+	return ""
+}
+
+func (ql *QuestLog) OnItemCollected(g *Game, species string) {
+	for _, q := range ql.active {
+		for i, o := range q.def.Objectives {
+			if o.Kind == ObjectiveCollect && (o.Species == "" || o.Species == species) && !q.objectiveDone(i) {
+				q.progress[i]++
+			}
+		}
+	}
+	ql.finishQuests(g)
+}
+
+// FishNeeded is how many more fish the objective still needs, and the
+// species if it wants one, so the level can keep enough of them around
+func (ql *QuestLog) FishNeeded(g *Game) (int, string) {
+	for _, q := range ql.active {
+		if q.def.ID != ql.objective {
+			continue
+		}
+		for i, o := range q.def.Objectives {
+			if q.objectiveDone(i) {
+				continue
+			}
+			switch o.Kind {
+			case ObjectiveCollect:
+				return o.Count - q.progress[i], o.Species
+			case ObjectiveDeliver:
+				return o.Count - carrying(g, o.Species), o.Species
+			}
+		}
+	}
+	return 0, ""
+}
+
+// carrying is how many fish the cat has eaten this level, of the species if
+// one is given
+func carrying(g *Game, species string) int {
+	if species != "" {
+		return g.fishBySpecies[species]
+	}
+	return g.itemsCollected
+}
+
+// OnTalk completes deliver objectives for this NPC if the player is carrying
+// enough fish, taking the fish away
+func (ql *QuestLog) OnTalk(g *Game, npcID string) {
+	for _, q := range ql.active {
+		for i, o := range q.def.Objectives {
+			if o.Kind != ObjectiveDeliver || o.NPC != npcID || q.objectiveDone(i) {
+				continue
+			}
+
+			if carrying(g, o.Species) < o.Count {
+				continue
+			}
+
+			g.itemsCollected -= o.Count
+			if o.Species != "" {
+				g.fishBySpecies[o.Species] -= o.Count
+			}
+			ql.takeFish(q, o.Count, o.Species)
+			q.progress[i] = 1
+		}
+	}
+	ql.finishQuests(g)
+}
+
+// takeFish takes delivered fish back off the level objective, since the cat
+// no longer has them. The quest they were delivered for keeps its own count.
+func (ql *QuestLog) takeFish(from *Quest, n int, species string) {
+	for _, q := range ql.active {
+		if q == from || q.def.ID != ql.objective {
+			continue
+		}
+		for i, o := range q.def.Objectives {
+			if o.Kind == ObjectiveCollect && (o.Species == "" || o.Species == species) {
+				q.progress[i] = max(0, q.progress[i]-n)
+			}
+		}
+	}
+}
+
+func (ql *QuestLog) OnPlayerHit() {
+	for _, q := range ql.active {
+		for i, o := range q.def.Objectives {
+			if o.Kind == ObjectiveAvoidCars && !q.objectiveDone(i) {
+				q.progress[i] = 0
+			}
+		}
+	}
+}
+
+// Update advances timers and location checks, called every tick while playing
+func (ql *QuestLog) Update(g *Game) {
+	px, py, pw, ph := g.player.GetBounds()
+	cx := px + pw/2
+	cy := py + ph/2
+
+	for _, q := range ql.active {
+		for i, o := range q.def.Objectives {
+			if q.objectiveDone(i) {
+				continue
+			}
+			switch o.Kind {
+			case ObjectiveAvoidCars:
+				if len(g.cars) > 0 {
+					q.progress[i]++
+				}
+			case ObjectiveReach:
+				dx, dy := cx-o.X, cy-o.Y
+				if dx*dx+dy*dy <= o.Radius*o.Radius {
+					q.progress[i] = 1
+				}
+			}
+		}
+	}
+	ql.finishQuests(g)
+}
+
+func (ql *QuestLog) finishQuests(g *Game) {
+	var done []*Quest
+	remaining := ql.active[:0]
+	for _, q := range ql.active {
+		if !q.done() {
+			remaining = append(remaining, q)
+			continue
+		}
+		ql.completed[q.def.ID] = true
+		done = append(done, q)
+	}
+	ql.active = remaining
+
+	// Rewards can move other quests along (given fish count as eaten), so
+	// they're handed out once the list is settled
+	for _, q := range done {
+		g.applyEffect(q.def.Reward)
+		g.showToast("Quest complete: " + q.def.Title)
+	}
+}
+
+// progressText describes how far along an objective is, e.g. "3/5"
+func (q *Quest) progressText(i int) string {
+	o := q.def.Objectives[i]
+	switch o.Kind {
+	case ObjectiveAvoidCars:
+		return fmt.Sprintf("%ds/%ds", q.progress[i]/ebiten.DefaultTPS, o.Seconds)
+	case ObjectiveCollect:
+		return fmt.Sprintf("%d/%d", q.progress[i], o.Count)
+	}
+	if q.objectiveDone(i) {
+		return "done"
+	}
+	return ""
+}
+
+// drawTracker shows the first active quest under the HUD bar. The level
+// objective is on the HUD's portal line instead.
+func (ql *QuestLog) drawTracker(screen *ebiten.Image) {
+	var q *Quest
+	for _, active := range ql.active {
+		if active.def.ID != ql.objective {
+			q = active
+			break
+		}
+	}
+	if q == nil {
+		return
+	}
+
+	for i := range q.def.Objectives {
+		if !q.objectiveDone(i) {
+			line := fmt.Sprintf("%s: %s %s", q.def.Title, q.def.Objectives[i].Text, q.progressText(i))
+			text.Draw(screen, line, basicfont.Face7x13, 10, 56, color.RGBA{255, 215, 0, 255})
+			return
+		}
+	}
+}
+
+func (ql *QuestLog) Draw(screen *ebiten.Image) {
+	if !ql.open {
+		return
+	}
+
+	panel := ebiten.NewImage(screenWidth-160, screenHeight-160)
+	panel.Fill(color.RGBA{20, 20, 40, 230})
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(80, 80)
+	screen.DrawImage(panel, op)
+
+	text.Draw(screen, "QUEST LOG", basicfont.Face7x13, 100, 105, color.RGBA{255, 215, 0, 255})
+	text.Draw(screen, "Q: Close", basicfont.Face7x13, screenWidth-160, 105, color.RGBA{200, 200, 200, 255})
+
+	y := 135
+	if len(ql.active) == 0 {
+		text.Draw(screen, "No active quests.", basicfont.Face7x13, 100, y, color.White)
+		y += 20
+	}
+	for _, q := range ql.active {
+		text.Draw(screen, q.def.Title, basicfont.Face7x13, 100, y, color.White)
+		y += 15
+		for _, line := range wrapText(q.def.Description, 80) {
+			text.Draw(screen, line, basicfont.Face7x13, 110, y, color.RGBA{180, 180, 180, 255})
+			y += 15
+		}
+		for i, o := range q.def.Objectives {
+			mark := "[ ]"
+			if q.objectiveDone(i) {
+				mark = "[x]"
+			}
+			text.Draw(screen, fmt.Sprintf("%s %s %s", mark, o.Text, q.progressText(i)), basicfont.Face7x13, 110, y, color.White)
+			y += 15
+		}
+		y += 10
+	}
+
+	var done []string
+	for id := range ql.completed {
+		if def := ql.defs[id]; def != nil {
+			done = append(done, def.Title)
+		}
+	}
+	sort.Strings(done)
+	for _, title := range done {
+		text.Draw(screen, "[done] "+title, basicfont.Face7x13, 100, y, color.RGBA{120, 200, 120, 255})
+		y += 15
+	}
+}
+
+// QuestSaveData is the quest part of a save file
+type QuestSaveData struct {
+	Active    []QuestProgress `json:"active"`
+	Completed []string        `json:"completed"`
+}
+
+type QuestProgress struct {
+	ID       string `json:"id"`
+	Progress []int  `json:"progress"`
+}
+
+func (ql *QuestLog) SaveState() QuestSaveData {
+	var data QuestSaveData
+	for _, q := range ql.active {
+		data.Active = append(data.Active, QuestProgress{ID: q.def.ID, Progress: append([]int(nil), q.progress...)})
+	}
+	for id := range ql.completed {
+		data.Completed = append(data.Completed, id)
+	}
+	sort.Strings(data.Completed)
+	return data
+}
+
+func (ql *QuestLog) LoadState(data QuestSaveData) {
+	ql.Reset()
+	for _, id := range data.Completed {
+		ql.completed[id] = true
+	}
+	for _, p := range data.Active {
+		def := ql.defs[p.ID]
+		if def == nil {
+			continue
+		}
+		q := &Quest{def: def, progress: make([]int, len(def.Objectives))}
+		copy(q.progress, p.Progress)
+		ql.active = append(ql.active, q)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const saveVersion = 2
+
+// SaveData is what F5 writes to disk and F9 reads back
+type SaveData struct {
+	Version        int             `json:"version"`
+	Level          int             `json:"level"`
+	Lives          int             `json:"lives"`
+	ItemsCollected int             `json:"itemsCollected"`
+	Score          int             `json:"score"`
+	LevelScore     LevelScore      `json:"levelScore"`
+	Results        []LevelScore    `json:"results,omitempty"` // finished levels of the run
+	FishBySpecies  map[string]int  `json:"fishBySpecies"`
+	PortalUnlocked bool            `json:"portalUnlocked"`
+	DialogueFlags  map[string]bool `json:"dialogueFlags"`
+	Quests         QuestSaveData   `json:"quests"`
+	Seed           int64           `json:"seed,omitempty"` // regenerates endless mode levels
+}
+
+// dataDir is where saves and settings live, e.g. ~/.config/catsquest
+func dataDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "catsquest"), nil
+}
+
+func savePath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "save.json"), nil
+}
+
+func (g *Game) saveGame() error {
+	data := SaveData{
+		Version:        saveVersion,
+		Level:          g.currentLevel,
+		Lives:          g.lives,
+		ItemsCollected: g.itemsCollected,
+		Score:          g.score,
+		LevelScore:     g.levelScore,
+		Results:        g.results,
+		FishBySpecies:  g.fishBySpecies,
+		PortalUnlocked: g.portalUnlocked,
+		DialogueFlags:  g.dialogueFlags,
+		Quests:         g.quests.SaveState(),
+		Seed:           g.options.Seed,
+	}
+
+	path, err := savePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Written to a temporary file first, so a crash while saving can't leave
+	// half a save behind
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadGame restores a save. Items are respawned fresh for the saved level.
+func (g *Game) loadGame() error {
+	path, err := savePath()
+	if err != nil {
+		return err
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var data SaveData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return err
+	}
+	if data.Version != saveVersion {
+		return fmt.Errorf("unsupported save version %d", data.Version)
+	}
+	if data.Level < 1 {
+		return fmt.Errorf("invalid level %d in save", data.Level)
+	}
+	if data.Level >= len(levelMaps) && data.Seed == 0 {
+		return fmt.Errorf("save of endless level %d has no seed", data.Level)
+	}
+	if data.Seed != 0 {
+		g.options.Seed = data.Seed
+	}
+
+	g.currentLevel = data.Level
+	g.loadLevel(data.Level)
+	g.disqualifyRun()
+
+	g.state = StatePlaying
+	g.lives = data.Lives
+	g.itemsCollected = data.ItemsCollected
+	g.levelScore = data.LevelScore
+	g.levelScore.Level = data.Level
+	g.results = append([]LevelScore(nil), data.Results...)
+	g.updateRunScore()
+	g.fishBySpecies = make(map[string]int)
+	for k, v := range data.FishBySpecies {
+		g.fishBySpecies[k] = v
+	}
+	g.portalUnlocked = data.PortalUnlocked
+	g.dialogueFlags = make(map[string]bool)
+	for k, v := range data.DialogueFlags {
+		g.dialogueFlags[k] = v
+	}
+	g.quests.LoadState(data.Quests)
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+// ScoreRules is how points are worked out, from the "scoring" block in
+// items.json. Fish are worth their species' points.
+type ScoreRules struct {
+	ComboSeconds  float64 `json:"comboSeconds"`  // time allowed between fish to keep a combo going
+	ComboStep     float64 `json:"comboStep"`     // multiplier added for each fish in a combo
+	MaxMultiplier float64 `json:"maxMultiplier"` // combo multiplier cap
+	ParSeconds    float64 `json:"parSeconds"`    // finishing a level quicker than this earns a bonus
+	TimeBonus     int     `json:"timeBonus"`     // points per second under par
+	LifePenalty   int     `json:"lifePenalty"`   // points lost per life lost
+}
+
+var defaultScoreRules = ScoreRules{
+	ComboSeconds:  2,
+	ComboStep:     0.5,
+	MaxMultiplier: 3,
+	ParSeconds:    120,
+	TimeBonus:     5,
+	LifePenalty:   100,
+}
+
+// LevelScore is the breakdown of one level's points
+type LevelScore struct {
+	Level     int `json:"level"`
+	Fish      int `json:"fish"`      // species points
+	Combo     int `json:"combo"`     // extra points from combo multipliers
+	BestCombo int `json:"bestCombo"` // most fish in one combo
+	Ticks     int `json:"ticks"`     // level time, see updateTimer
+	TimeBonus int `json:"timeBonus"`
+	LivesLost int `json:"livesLost"`
+	Penalty   int `json:"penalty"`
+}
+
+// Total is the level's points, never below zero
+func (s LevelScore) Total() int {
+	return max(0, s.Fish+s.Combo+s.TimeBonus-s.Penalty)
+}
+
+// startLevelScore begins a fresh breakdown for a level
+func (g *Game) startLevelScore(level int) {
+	g.levelScore = LevelScore{Level: level}
+	g.combo = 0
+	g.comboTimer = 0
+	g.updateRunScore()
+}
+
+// updateScore runs every tick the level is being played
+func (g *Game) updateScore() {
+	if g.comboTimer > 0 {
+		g.comboTimer--
+		if g.comboTimer == 0 {
+			g.combo = 0
+		}
+	}
+}
+
+// comboMultiplier is what the current combo multiplies fish points by
+func (g *Game) comboMultiplier() float64 {
+	rules := g.itemRegistry.Scoring
+	if g.combo < 2 {
+		return 1
+	}
+	return min(1+float64(g.combo-1)*rules.ComboStep, rules.MaxMultiplier)
+}
+
+// scoreFish adds a fish's points. Each fish eaten soon after the last one
+// raises the combo multiplier.
+func (g *Game) scoreFish(species *ItemSpecies) {
+	g.combo++
+	g.comboTimer = int(g.itemRegistry.Scoring.ComboSeconds * ebiten.DefaultTPS)
+	g.levelScore.BestCombo = max(g.levelScore.BestCombo, g.combo)
+
+	points := int(math.Round(float64(species.Points) * g.comboMultiplier()))
+	g.levelScore.Fish += species.Points
+	g.levelScore.Combo += points - species.Points
+	g.updateRunScore()
+}
+
+// scoreLifeLost takes off the life penalty and breaks the combo
+func (g *Game) scoreLifeLost() {
+	g.levelScore.LivesLost++
+	g.levelScore.Penalty += g.itemRegistry.Scoring.LifePenalty
+	g.combo = 0
+	g.comboTimer = 0
+	g.updateRunScore()
+}
+
+// finishLevelScore adds the time bonus and files the level's breakdown
+// with the rest of the run
+func (g *Game) finishLevelScore() {
+	rules := g.itemRegistry.Scoring
+	secondsUnder := rules.ParSeconds - float64(g.levelScore.Ticks)/ebiten.DefaultTPS
+	if secondsUnder > 0 {
+		g.levelScore.TimeBonus = int(secondsUnder) * rules.TimeBonus
+	}
+	g.results = append(g.results, g.levelScore)
+	g.levelScore = LevelScore{Level: g.levelScore.Level}
+	g.updateRunScore()
+}
+
+// updateRunScore recomputes the score shown in the HUD: every finished
+// level plus the one being played
+func (g *Game) updateRunScore() {
+	g.score = 0
+	for _, s := range g.results {
+		g.score += s.Total()
+	}
+	g.score += g.levelScore.Total()
+}
+
+// drawCombo shows the combo multiplier while one is going
+func (g *Game) drawCombo(screen *ebiten.Image) {
+	if g.combo < 2 {
+		return
+	}
+	msg := fmt.Sprintf("Combo %d  x%.1f", g.combo, g.comboMultiplier())
+	text.Draw(screen, msg, basicfont.Face7x13, screenWidth-len(msg)*7-10, 72, color.RGBA{255, 160, 40, 255})
+}
+
+// formatTicks shows a tick count as m:ss.cc
+func formatTicks(ticks int) string {
+	hundredths := ticks * 100 / ebiten.DefaultTPS
+	return fmt.Sprintf("%d:%02d.%02d", hundredths/6000, hundredths/100%60, hundredths%100)
+}
+
+// drawScoreLines draws one level's breakdown, returning the y below it
+func drawScoreLines(screen *ebiten.Image, s LevelScore, x, y int) int {
+	lines := []string{
+		fmt.Sprintf("Fish           %6d", s.Fish),
+		fmt.Sprintf("Combo bonus    %6d   (best combo %d)", s.Combo, s.BestCombo),
+		fmt.Sprintf("Time bonus     %6d   (%s)", s.TimeBonus, formatTicks(s.Ticks)),
+		fmt.Sprintf("Lives lost     %6d   (%d lost)", -s.Penalty, s.LivesLost),
+		fmt.Sprintf("Level total    %6d", s.Total()),
+	}
+	for i, line := range lines {
+		clr := color.Color(color.White)
+		if i == len(lines)-1 {
+			clr = color.RGBA{255, 215, 0, 255}
+		}
+		text.Draw(screen, line, basicfont.Face7x13, x, y, clr)
+		y += 18
+	}
+	return y
+}
+
+// drawLevelResults is the screen between levels
+func (g *Game) drawLevelResults(screen *ebiten.Image) {
+	s := g.results[len(g.results)-1]
+	title := fmt.Sprintf("LEVEL %d COMPLETE!", s.Level)
+	text.Draw(screen, title, basicfont.Face7x13, screenWidth/2-len(title)*7/2, 170, color.RGBA{255, 215, 0, 255})
+
+	y := drawScoreLines(screen, s, screenWidth/2-140, 220)
+	g.drawSplit(screen, s, screenWidth/2-140, y+20)
+	text.Draw(screen, fmt.Sprintf("Score so far  %7d", g.score), basicfont.Face7x13, screenWidth/2-140, y+40, color.White)
+	text.Draw(screen, "Press Enter to continue", basicfont.Face7x13, screenWidth/2-80, y+70, color.RGBA{200, 200, 200, 255})
+}
+
+// drawFinalScore lists every level of the run and the final total
+func (g *Game) drawFinalScore(screen *ebiten.Image, y int) int {
+	x := screenWidth/2 - 170
+	text.Draw(screen, "Level    Fish  Combo   Time  Lives   Total", basicfont.Face7x13, x, y, color.RGBA{200, 200, 200, 255})
+	y += 20
+	for _, s := range g.results {
+		line := fmt.Sprintf("%5d  %6d %6d %6d %6d  %6d", s.Level, s.Fish, s.Combo, s.TimeBonus, -s.Penalty, s.Total())
+		text.Draw(screen, line, basicfont.Face7x13, x, y, color.White)
+		y += 16
+	}
+	y += 8
+	text.Draw(screen, fmt.Sprintf("Final score %d points", g.score), basicfont.Face7x13, x, y, color.RGBA{255, 215, 0, 255})
+	return y + 20
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+const settingsVersion = 1
+
+// Settings are player preferences kept between runs
+type Settings struct {
+	Version int                `json:"version"`
+	Master  float64            `json:"masterVolume"`
+	Volumes map[string]float64 `json:"volumes"` // by bus name
+	Muted   bool               `json:"muted"`
+	Ghost   bool               `json:"ghost"` // race the personal best's ghost
+}
+
+func defaultSettings() Settings {
+	s := Settings{Version: settingsVersion, Master: 1, Volumes: make(map[string]float64), Ghost: true}
+	for _, name := range busNames {
+		s.Volumes[name] = 1
+	}
+	s.Volumes["music"] = 0.6
+	return s
+}
+
+func settingsPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "settings.json"), nil
+}
+
+// loadSettings reads the settings file. Defaults are used if it's missing
+// or broken, and for anything it leaves out.
+func loadSettings() Settings {
+	s := defaultSettings()
+	path, err := settingsPath()
+	if err != nil {
+		return s
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to read settings: %v", err)
+		return s
+	}
+
+	if err := json.Unmarshal(raw, &s); err != nil {
+		log.Printf("Warning: Ignoring broken settings file %s: %v", path, err)
+		return defaultSettings()
+	}
+	if s.Volumes == nil {
+		s.Volumes = defaultSettings().Volumes
+	}
+	s.Version = settingsVersion
+	return s
+}
+
+// saveSettings goes through a temporary file too, like the save file
+func saveSettings(s Settings) error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// applySettings sets the mixer volumes from the settings
+func (g *Game) applySettings() {
+	mixer := g.audioManager.mixer
+	mixer.SetMaster(g.settings.Master)
+	for name, volume := range g.settings.Volumes {
+		if bus, ok := busByName(name); ok {
+			mixer.SetVolume(bus, volume)
+		}
+	}
+	mixer.SetMuted(g.settings.Muted || g.options.Mute)
+}
+
+// storeSettings copies the mixer volumes back into the settings and saves
+// them. Muted isn't taken from the mixer, which is also muted by -mute for
+// just this session; only toggleMute changes it.
+func (g *Game) storeSettings() {
+	mixer := g.audioManager.mixer
+	g.settings.Master = mixer.Master()
+	for i, name := range busNames {
+		g.settings.Volumes[name] = mixer.Volume(Bus(i))
+	}
+	if err := saveSettings(g.settings); err != nil {
+		log.Printf("Warning: Failed to save settings: %v", err)
+	}
+}
+
+// toggleMute is the M key. The choice is saved, so it overrides -mute.
+func (g *Game) toggleMute() {
+	mixer := g.audioManager.mixer
+	g.settings.Muted = !mixer.Muted()
+	mixer.SetMuted(g.settings.Muted)
+	g.storeSettings()
+	if mixer.Muted() {
+		g.showToast("Sound off")
+	} else {
+		g.showToast("Sound on")
+		g.audioManager.Play("click")
+	}
+}
+
+// changeVolume nudges the master volume, for the - and = keys
+func (g *Game) changeVolume(delta float64) {
+	mixer := g.audioManager.mixer
+	mixer.SetMaster(math.Round((mixer.Master()+delta)*10) / 10)
+	g.storeSettings()
+	g.showToast(fmt.Sprintf("Volume %.0f%%", mixer.Master()*100))
+	g.audioManager.Play("click")
+}
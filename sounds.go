@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2/audio/mp3"
+	"github.com/hajimehoshi/ebiten/v2/audio/vorbis"
+	"github.com/hajimehoshi/ebiten/v2/audio/wav"
+)
+
+const soundsFile = "assets/data/sounds.json"
+
+// Pitch jitter is rounded to steps of this size so only a few pitched
+// copies of each sound are ever made
+const pitchStep = 0.02
+
+// SoundEvent is one thing the game can play, e.g. "eat". One of the files
+// is picked at random each time, at a slightly random pitch.
+type SoundEvent struct {
+	Bus         string   `json:"bus,omitempty"` // "sfx" if empty
+	Files       []string `json:"files"`
+	Volume      float64  `json:"volume,omitempty"`      // 1 if empty
+	PitchJitter float64  `json:"pitchJitter,omitempty"` // 0.1 = up to 10% higher or lower
+
+	bus Bus
+}
+
+// SoundRegistry is the sound manifest: events by name, and music tracks
+// by the name levels use in their "music" map property
+type SoundRegistry struct {
+	Events       map[string]*SoundEvent `json:"events"`
+	Music        map[string]string      `json:"music"`
+	DefaultMusic string                 `json:"defaultMusic"` // for levels that don't pick
+}
+
+// LoadSoundRegistry reads and checks the manifest. The sound files
+// themselves are loaded by the AudioManager.
+func LoadSoundRegistry(fsys fs.FS, file string) (*SoundRegistry, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SoundRegistry{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	for name, ev := range r.Events {
+		if len(ev.Files) == 0 {
+			return nil, fmt.Errorf("%s: event %q has no files", file, name)
+		}
+		if ev.Bus == "" {
+			ev.Bus = "sfx"
+		}
+		bus, ok := busByName(ev.Bus)
+		if !ok {
+			return nil, fmt.Errorf("%s: event %q has unknown bus %q", file, name, ev.Bus)
+		}
+		ev.bus = bus
+		if ev.Volume == 0 {
+			ev.Volume = 1
+		}
+		if ev.PitchJitter < 0 || ev.PitchJitter > 0.5 {
+			return nil, fmt.Errorf("%s: event %q pitch jitter must be between 0 and 0.5", file, name)
+		}
+	}
+	if r.DefaultMusic != "" && r.Music[r.DefaultMusic] == "" {
+		return nil, fmt.Errorf("%s: default music %q isn't in the music list", file, r.DefaultMusic)
+	}
+	return r, nil
+}
+
+// Files lists every sound effect file the manifest uses
+func (r *SoundRegistry) Files() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, ev := range r.Events {
+		for _, f := range ev.Files {
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// MusicFiles lists every music file in the manifest
+func (r *SoundRegistry) MusicFiles() []string {
+	var files []string
+	for _, f := range r.Music {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// soundStream is a decoded sound, read as 16-bit stereo PCM
+type soundStream interface {
+	io.ReadSeeker
+	Length() int64
+}
+
+// decodeStream decodes an MP3, OGG/Vorbis or WAV file as it's read,
+// resampled to the game's sample rate
+func decodeStream(name string, data []byte) (soundStream, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".mp3":
+		return mp3.DecodeWithSampleRate(sampleRate, bytes.NewReader(data))
+	case ".ogg":
+		return vorbis.DecodeWithSampleRate(sampleRate, bytes.NewReader(data))
+	case ".wav":
+		return wav.DecodeWithSampleRate(sampleRate, bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("unsupported sound format %q", path.Ext(name))
+}
+
+// decodeSound decodes a whole sound file into memory
+func decodeSound(name string, data []byte) ([]byte, error) {
+	stream, err := decodeStream(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(stream)
+}
+
+// pitchShift resamples PCM so it plays faster and higher (pitch > 1) or
+// slower and lower (pitch < 1)
+func pitchShift(pcm []byte, pitch float64) []byte {
+	frames := len(pcm) / pcmFrameSize
+	if frames == 0 {
+		return pcm
+	}
+	outFrames := int(float64(frames) / pitch)
+	out := make([]byte, outFrames*pcmFrameSize)
+
+	sample := func(frame, channel int) float64 {
+		frame = min(frame, frames-1)
+		return float64(int16(binary.LittleEndian.Uint16(pcm[frame*pcmFrameSize+channel*2:])))
+	}
+	for i := 0; i < outFrames; i++ {
+		pos := float64(i) * pitch
+		frame := int(pos)
+		t := pos - float64(frame)
+		for ch := 0; ch < 2; ch++ {
+			s := sample(frame, ch)*(1-t) + sample(frame+1, ch)*t
+			binary.LittleEndian.PutUint16(out[i*pcmFrameSize+ch*2:], uint16(int16(s)))
+		}
+	}
+	return out
+}
+
+// randomPitch picks a pitch within the jitter, rounded to pitchStep
+func randomPitch(r, jitter float64) float64 {
+	pitch := 1 + (r*2-1)*jitter
+	return math.Round(pitch/pitchStep) * pitchStep
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	hearDistance  = 900.0 // sounds further from the cat than this are silent
+	engineVolume  = 0.25
+	honkVolume    = 0.7
+	npcStepVolume = 0.4
+)
+
+// spatial is how loud a sound at a world position is for the cat, and
+// where it sits between the speakers. Something half a screen to the side
+// is fully in one speaker, so traffic off the edge of the view can be heard
+// coming.
+func (g *Game) spatial(x, y float64) (gain, pan float64) {
+	dx := x - (g.player.x + float64(g.player.width)/2)
+	dy := y - (g.player.y + float64(g.player.height)/2)
+	gain = max(0, 1-math.Hypot(dx, dy)/hearDistance)
+	return gain * gain, max(-1, min(dx/(screenWidth/2), 1))
+}
+
+// playAt plays a sound event coming from a world position
+func (g *Game) playAt(event string, x, y, volume float64) {
+	gain, pan := g.spatial(x, y)
+	if gain > 0 {
+		g.audioManager.PlayAt(event, volume*gain, pan)
+	}
+}
+
+// updateSpatialAudio runs every tick. Each car within hearing distance has
+// a looping engine, and every car honks now and then; both are only heard
+// while the game is being played.
+func (g *Game) updateSpatialAudio() {
+	am := g.audioManager
+	playing := g.state == StatePlaying && !g.console.open && !g.quests.open
+
+	// Engines start and stop as cars come into and go out of earshot, or are
+	// added or removed
+	near := make(map[*Car]bool)
+	for _, car := range g.cars {
+		cx, cy := car.x+float64(car.width)/2, car.y+float64(car.height)/2
+		gain, pan := g.spatial(cx, cy)
+		if gain > 0 {
+			near[car] = true
+			engine, ok := g.engines[car]
+			if !ok {
+				engine = am.mixer.Loop(BusSFX, "engine", am.enginePCM(car.maxSpeed), 0)
+				g.engines[car] = engine
+			}
+			if !playing {
+				gain = 0
+			}
+			if engine != nil {
+				engine.SetGain(am.mixer, engineVolume*gain)
+				engine.SetPan(pan)
+			}
+		}
+
+		if !playing {
+			continue
+		}
+		if car.honkTimer > 0 {
+			car.honkTimer--
+			if car.honkTimer == 0 {
+				g.playAt("honk", cx, cy, honkVolume)
+			}
+		}
+		if car.honkTimer == 0 {
+			// 5 to 15 seconds until the next one
+			car.honkTimer = 300 + am.rng.Intn(600)
+		}
+	}
+	for car, engine := range g.engines {
+		if !near[car] {
+			if engine != nil {
+				am.mixer.RemoveStream(engine)
+			}
+			delete(g.engines, car)
+		}
+	}
+}
+
+// enginePCM synthesizes a one second engine loop, pitched up for faster
+// cars. There's no engine sound asset.
+func (am *AudioManager) enginePCM(speed float64) []byte {
+	// Whole, even cycles per second so the loop has no click
+	freq := 2 * int(math.Round((40+speed*8)/2))
+	name := fmt.Sprintf("engine %dHz", freq)
+	if pcm := am.mixer.sounds[name]; pcm != nil {
+		return pcm
+	}
+
+	pcm := make([]byte, sampleRate*pcmFrameSize)
+	for i := 0; i < sampleRate; i++ {
+		t := float64(i) / sampleRate
+		saw := 2*math.Mod(float64(freq)*t, 1) - 1
+		rumble := math.Sin(2 * math.Pi * float64(freq/2) * t)
+		wobble := 0.8 + 0.2*math.Sin(2*math.Pi*4*t)
+		sample := uint16(int16((0.5*saw + 0.5*rumble) * wobble * 0.5 * math.MaxInt16))
+		binary.LittleEndian.PutUint16(pcm[i*pcmFrameSize:], sample)
+		binary.LittleEndian.PutUint16(pcm[i*pcmFrameSize+2:], sample)
+	}
+	am.mixer.Load(name, pcm)
+	return pcm
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const itemsFile = "assets/data/items.json"
+
+// Item behaviors
+const (
+	BehaviorNone = ""
+	BehaviorFlop = "flop" // hops around on the spot
+	BehaviorFlee = "flee" // swims away from the cat when it gets close
+)
+
+// ItemSpecies describes one kind of pickup. Good species and power-ups are
+// drawn by Weight when spawning; bad species are spawned PerLevel times each.
+type ItemSpecies struct {
+	Name     string    `json:"name"`
+	Image    string    `json:"image"`
+	Kind     string    `json:"kind"`               // "good", "bad" or "powerup"
+	Tint     []float32 `json:"tint,omitempty"`     // RGB color scale
+	Harmless bool      `json:"harmless,omitempty"` // bad item that only applies its effect
+	Points   int       `json:"points,omitempty"`
+	Weight   int       `json:"weight,omitempty"`
+	PerLevel int       `json:"perLevel,omitempty"`
+	Behavior string    `json:"behavior,omitempty"`
+	Lifetime float64   `json:"lifetime,omitempty"` // seconds before despawning, 0 = never
+	Effect   *Effect   `json:"effect,omitempty"`   // applied on pickup
+	Terrain  []string  `json:"terrain,omitempty"`  // terrains it spawns on, empty = any
+
+	image *ebiten.Image
+}
+
+func (s *ItemSpecies) ItemType() ItemType {
+	switch s.Kind {
+	case "bad":
+		return ItemBad
+	case "powerup":
+		return ItemPowerUp
+	}
+	return ItemGood
+}
+
+// ItemPlacement is the rules for scattering items over a level. Distances
+// are in pixels between item centers.
+type ItemPlacement struct {
+	Spacing      float64  `json:"spacing"`      // between two items
+	StartRadius  float64  `json:"startRadius"`  // kept clear around the cat's start
+	PortalRadius float64  `json:"portalRadius"` // and around the portal
+	CarRadius    float64  `json:"carRadius"`    // and around car lanes, or where roaming cars start
+	AvoidTerrain []string `json:"avoidTerrain"` // tile terrains nothing spawns on
+}
+
+var defaultPlacement = ItemPlacement{
+	Spacing:      80,
+	StartRadius:  200,
+	PortalRadius: 150,
+	CarRadius:    120,
+	AvoidTerrain: []string{"road"},
+}
+
+type ItemRegistry struct {
+	GoodPerLevel    int            `json:"goodPerLevel"`
+	PowerUpPerLevel int            `json:"powerUpPerLevel"`
+	Placement       ItemPlacement  `json:"placement"`
+	Scoring         ScoreRules     `json:"scoring"`
+	Species         []*ItemSpecies `json:"species"`
+
+	byName      map[string]*ItemSpecies
+	totalWeight map[string]int // by kind
+}
+
+// LoadItemRegistry reads the species list and loads each species' image
+// with loadImage.
+func LoadItemRegistry(fsys fs.FS, file string, loadImage func(string) *ebiten.Image) (*ItemRegistry, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Anything left out of the file keeps its default
+	r := &ItemRegistry{Placement: defaultPlacement, Scoring: defaultScoreRules}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	r.byName = make(map[string]*ItemSpecies)
+	r.totalWeight = make(map[string]int)
+	for _, s := range r.Species {
+		if s.Kind != "good" && s.Kind != "bad" && s.Kind != "powerup" {
+			return nil, fmt.Errorf("%s: species %q has unknown kind %q", file, s.Name, s.Kind)
+		}
+		if s.Behavior != BehaviorNone && s.Behavior != BehaviorFlop && s.Behavior != BehaviorFlee {
+			return nil, fmt.Errorf("%s: species %q has unknown behavior %q", file, s.Name, s.Behavior)
+		}
+		s.image = loadImage(s.Image)
+		r.byName[s.Name] = s
+		r.totalWeight[s.Kind] += s.Weight
+	}
+	if r.totalWeight["good"] <= 0 {
+		return nil, fmt.Errorf("%s: no good species with a weight", file)
+	}
+
+	return r, nil
+}
+
+func (r *ItemRegistry) Get(name string) *ItemSpecies {
+	return r.byName[name]
+}
+
+// PickGood returns a random good species, weighted by rarity
+func (r *ItemRegistry) PickGood() *ItemSpecies {
+	return r.pick("good")
+}
+
+// PickPowerUp returns a random power-up, or nil if there are none
+func (r *ItemRegistry) PickPowerUp() *ItemSpecies {
+	return r.pick("powerup")
+}
+
+func (r *ItemRegistry) pick(kind string) *ItemSpecies {
+	if r.totalWeight[kind] <= 0 {
+		return nil
+	}
+	n := rng.Intn(r.totalWeight[kind])
+	for _, s := range r.Species {
+		if s.Kind != kind {
+			continue
+		}
+		if n < s.Weight {
+			return s
+		}
+		n -= s.Weight
+	}
+	return nil
+}
+
+// Good returns all the fish species
+func (r *ItemRegistry) Good() []*ItemSpecies {
+	var good []*ItemSpecies
+	for _, s := range r.Species {
+		if s.Kind == "good" {
+			good = append(good, s)
+		}
+	}
+	return good
+}
+
+// Bad returns all the hazard species
+func (r *ItemRegistry) Bad() []*ItemSpecies {
+	var bad []*ItemSpecies
+	for _, s := range r.Species {
+		if s.Kind == "bad" {
+			bad = append(bad, s)
+		}
+	}
+	return bad
+}
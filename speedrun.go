@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+const (
+	speedrunVersion = 1
+	ghostAlpha      = 0.4
+)
+
+// ghostFrame is where the cat was, and what it looked like, on one tick
+type ghostFrame struct {
+	x, y       int
+	dir, frame int
+	state      string
+}
+
+// GhostTrack is the cat's path through one level. On disk the frames are
+// flattened to x, y, direction, state and animation frame per tick, with
+// the state as an index into States, to keep the file small.
+type GhostTrack struct {
+	States []string `json:"states"`
+	Frames []int    `json:"frames"`
+}
+
+// PersonalBest is the fastest full run, from level 1 to the win screen
+type PersonalBest struct {
+	Version int          `json:"version"`
+	Splits  []int        `json:"splits"` // run time at the end of each level, in ticks
+	Ghosts  []GhostTrack `json:"ghosts"` // by level, from level 1
+
+	ghosts [][]ghostFrame
+}
+
+func speedrunPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "speedrun.json"), nil
+}
+
+// loadPersonalBest reads the personal best, nil if there isn't a usable one
+func loadPersonalBest() *PersonalBest {
+	path, err := speedrunPath()
+	if err != nil {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to read personal best: %v", err)
+		return nil
+	}
+
+	var pb PersonalBest
+	if err := json.Unmarshal(raw, &pb); err != nil {
+		log.Printf("Warning: Ignoring broken personal best %s: %v", path, err)
+		return nil
+	}
+	if pb.Version != speedrunVersion || len(pb.Splits) != len(levelMaps)-1 {
+		log.Printf("Warning: Ignoring personal best %s from a different version", path)
+		return nil
+	}
+	for i, split := range pb.Splits {
+		if split <= 0 || (i > 0 && split < pb.Splits[i-1]) {
+			log.Printf("Warning: Ignoring personal best %s with bad splits", path)
+			return nil
+		}
+	}
+	for _, track := range pb.Ghosts {
+		pb.ghosts = append(pb.ghosts, track.decode())
+	}
+	return &pb
+}
+
+func (pb *PersonalBest) Save() error {
+	path, err := speedrunPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	pb.Ghosts = nil
+	for _, frames := range pb.ghosts {
+		pb.Ghosts = append(pb.Ghosts, encodeGhost(frames))
+	}
+	out, err := json.Marshal(pb)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func encodeGhost(frames []ghostFrame) GhostTrack {
+	var track GhostTrack
+	stateIndex := make(map[string]int)
+	for _, f := range frames {
+		i, ok := stateIndex[f.state]
+		if !ok {
+			i = len(track.States)
+			stateIndex[f.state] = i
+			track.States = append(track.States, f.state)
+		}
+		track.Frames = append(track.Frames, f.x, f.y, f.dir, i, f.frame)
+	}
+	return track
+}
+
+// decode unpacks a track, stopping at anything that doesn't fit
+func (t GhostTrack) decode() []ghostFrame {
+	var frames []ghostFrame
+	for i := 0; i+5 <= len(t.Frames); i += 5 {
+		v := t.Frames[i : i+5]
+		if v[3] < 0 || v[3] >= len(t.States) {
+			break
+		}
+		frames = append(frames, ghostFrame{x: v[0], y: v[1], dir: v[2], state: t.States[v[3]], frame: v[4]})
+	}
+	return frames
+}
+
+// startRun resets the speedrun for a new run. Only runs from level 1 on the
+// real maps can set a personal best. The timescale cheat doesn't carry over.
+func (g *Game) startRun() {
+	ebiten.SetTPS(ebiten.DefaultTPS)
+	g.runCounts = g.options.Level == 1 && g.options.MapFile == ""
+	g.cheated = false
+	g.ghostRecording = nil
+	g.newPB = false
+}
+
+// disqualifyRun stops the current run from setting a personal best, e.g.
+// after a cheat or a quick load
+func (g *Game) disqualifyRun() {
+	g.runCounts = false
+	g.cheated = true
+}
+
+// runTicks is the run's time so far: every finished level plus this one
+func (g *Game) runTicks() int {
+	ticks := g.levelScore.Ticks
+	for _, s := range g.results {
+		ticks += s.Ticks
+	}
+	return ticks
+}
+
+// updateTimer runs every tick the level clock is running, and records the
+// cat for the ghost
+func (g *Game) updateTimer() {
+	g.levelScore.Ticks++
+
+	level := g.currentLevel - 1
+	if !g.runCounts || level >= len(levelMaps)-1 {
+		return
+	}
+	for len(g.ghostRecording) <= level {
+		g.ghostRecording = append(g.ghostRecording, nil)
+	}
+	p := g.player
+	g.ghostRecording[level] = append(g.ghostRecording[level], ghostFrame{
+		x: int(p.x), y: int(p.y), dir: p.direction, state: p.anim.Current(), frame: p.anim.Frame(),
+	})
+}
+
+// finishRun checks a won run against the personal best and keeps it if
+// it's faster
+func (g *Game) finishRun() {
+	if !g.runCounts || len(g.results) != len(levelMaps)-1 || len(g.ghostRecording) != len(g.results) {
+		return
+	}
+	var splits []int
+	total := 0
+	for _, s := range g.results {
+		total += s.Ticks
+		splits = append(splits, total)
+	}
+	if g.personalBest != nil && total >= g.personalBest.Splits[len(splits)-1] {
+		return
+	}
+
+	g.personalBest = &PersonalBest{Version: speedrunVersion, Splits: splits, ghosts: g.ghostRecording}
+	g.newPB = true
+	if err := g.personalBest.Save(); err != nil {
+		log.Printf("Warning: Failed to save personal best: %v", err)
+	}
+}
+
+// pbSplit is the personal best's run time at the end of a level
+func (g *Game) pbSplit(level int) (int, bool) {
+	if !g.runCounts || g.personalBest == nil || level < 1 || level > len(g.personalBest.Splits) {
+		return 0, false
+	}
+	return g.personalBest.Splits[level-1], true
+}
+
+// splitDelta compares the run with the personal best: live once this level
+// is taking longer than the best did, otherwise at the last split
+func (g *Game) splitDelta() (int, bool) {
+	now := g.runTicks()
+	if split, ok := g.pbSplit(g.currentLevel); ok && now > split {
+		return now - split, true
+	}
+	done := now - g.levelScore.Ticks
+	if split, ok := g.pbSplit(g.currentLevel - 1); ok {
+		return done - split, true
+	}
+	return 0, false
+}
+
+// formatDelta shows a time difference as -1.25 or +1:02.50
+func formatDelta(ticks int) string {
+	sign := "+"
+	if ticks < 0 {
+		sign = "-"
+		ticks = -ticks
+	}
+	if ticks < 60*ebiten.DefaultTPS {
+		return fmt.Sprintf("%s%d.%02d", sign, ticks/ebiten.DefaultTPS, ticks%ebiten.DefaultTPS*100/ebiten.DefaultTPS)
+	}
+	return sign + formatTicks(ticks)
+}
+
+func deltaColor(ticks int) color.Color {
+	if ticks <= 0 {
+		return color.RGBA{80, 230, 80, 255}
+	}
+	return color.RGBA{255, 90, 90, 255}
+}
+
+// drawTimer shows the run time under the HUD, with the difference to the
+// personal best. The time is grey when the run can't set a best.
+func (g *Game) drawTimer(screen *ebiten.Image) {
+	clock := formatTicks(g.runTicks())
+	clr := color.Color(color.White)
+	if !g.runCounts {
+		clr = color.RGBA{150, 150, 150, 255}
+	}
+	x := screenWidth - 10
+	if delta, ok := g.splitDelta(); ok {
+		msg := formatDelta(delta)
+		x -= len(msg) * 7
+		text.Draw(screen, msg, basicfont.Face7x13, x, 56, deltaColor(delta))
+		x -= 7
+	}
+	text.Draw(screen, clock, basicfont.Face7x13, x-len(clock)*7, 56, clr)
+}
+
+// drawSplit is the split line on the results screen
+func (g *Game) drawSplit(screen *ebiten.Image, s LevelScore, x, y int) {
+	now := g.runTicks()
+	text.Draw(screen, fmt.Sprintf("Split       %s", formatTicks(now)), basicfont.Face7x13, x, y, color.White)
+	if split, ok := g.pbSplit(s.Level); ok {
+		text.Draw(screen, formatDelta(now-split)+" vs PB", basicfont.Face7x13, x+160, y, deltaColor(now-split))
+	}
+}
+
+// drawGhost draws the personal best's cat where it was at this point of
+// the level, until it reached the portal
+func (g *Game) drawGhost() {
+	if !g.settings.Ghost || !g.runCounts || g.personalBest == nil || g.state != StatePlaying {
+		return
+	}
+	level := g.currentLevel - 1
+	if level < 0 || level >= len(g.personalBest.ghosts) {
+		return
+	}
+	frames := g.personalBest.ghosts[level]
+	if g.levelScore.Ticks >= len(frames) {
+		return
+	}
+	f := frames[g.levelScore.Ticks]
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(f.x), float64(f.y))
+	op.ColorScale.Scale(0.6, 0.8, 1, 1)
+	op.ColorScale.ScaleAlpha(ghostAlpha)
+	g.player.anim.DrawState(g.world, op, f.state, f.frame, f.dir)
+}
+
+// toggleGhost is the G key. The choice is saved with the settings.
+func (g *Game) toggleGhost() {
+	g.settings.Ghost = !g.settings.Ghost
+	if err := saveSettings(g.settings); err != nil {
+		log.Printf("Warning: Failed to save settings: %v", err)
+	}
+	if g.settings.Ghost {
+		g.showToast("Ghost on")
+	} else {
+		g.showToast("Ghost off")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text"
+	"golang.org/x/image/font/basicfont"
+)
+
+// Status effect kinds
+const (
+	StatusSpeed      = "speed"
+	StatusInvincible = "invincible"
+	StatusMagnet     = "magnet"
+	StatusSlow       = "slow"
+)
+
+// How a status reacts to being applied while it's already active
+type StackRule int
+
+const (
+	StackRefresh StackRule = iota // keep whichever duration is longer
+	StackExtend                   // add the new duration, up to MaxSeconds
+)
+
+type StatusDef struct {
+	Label      string
+	Color      color.RGBA
+	Stack      StackRule
+	MaxSeconds float64
+	Cancels    string // applying this removes the other status
+}
+
+var statusDefs = map[string]StatusDef{
+	StatusSpeed:      {Label: "SPD", Color: color.RGBA{80, 200, 255, 255}, Stack: StackExtend, MaxSeconds: 20, Cancels: StatusSlow},
+	StatusInvincible: {Label: "INV", Color: color.RGBA{255, 215, 0, 255}, Stack: StackRefresh},
+	StatusMagnet:     {Label: "MAG", Color: color.RGBA{220, 80, 220, 255}, Stack: StackExtend, MaxSeconds: 30},
+	StatusSlow:       {Label: "SLO", Color: color.RGBA{140, 110, 80, 255}, Stack: StackRefresh, Cancels: StatusSpeed},
+}
+
+const (
+	speedBoostMultiplier = 1.6
+	slowMultiplier       = 0.5
+	magnetRadius         = 220.0
+	magnetPull           = 4.0
+)
+
+type StatusEffect struct {
+	kind      string
+	ticksLeft int
+}
+
+// AddStatus applies a status for the given number of seconds following its
+// stacking rule
+func (p *Player) AddStatus(kind string, seconds float64) {
+	def, ok := statusDefs[kind]
+	if !ok {
+		return
+	}
+	ticks := int(seconds * ebiten.DefaultTPS)
+
+	if def.Cancels != "" {
+		p.RemoveStatus(def.Cancels)
+	}
+
+	for _, s := range p.statuses {
+		if s.kind != kind {
+			continue
+		}
+		switch def.Stack {
+		case StackExtend:
+			s.ticksLeft += ticks
+			if limit := int(def.MaxSeconds * ebiten.DefaultTPS); limit > 0 && s.ticksLeft > limit {
+				s.ticksLeft = limit
+			}
+		default:
+			if ticks > s.ticksLeft {
+				s.ticksLeft = ticks
+			}
+		}
+		return
+	}
+
+	p.statuses = append(p.statuses, &StatusEffect{kind: kind, ticksLeft: ticks})
+}
+
+func (p *Player) RemoveStatus(kind string) {
+	kept := p.statuses[:0]
+	for _, s := range p.statuses {
+		if s.kind != kind {
+			kept = append(kept, s)
+		}
+	}
+	p.statuses = kept
+}
+
+func (p *Player) HasStatus(kind string) bool {
+	for _, s := range p.statuses {
+		if s.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearStatuses removes everything, e.g. after losing a life
+func (p *Player) ClearStatuses() {
+	p.statuses = nil
+}
+
+func (p *Player) updateStatuses() {
+	kept := p.statuses[:0]
+	for _, s := range p.statuses {
+		s.ticksLeft--
+		if s.ticksLeft > 0 {
+			kept = append(kept, s)
+		}
+	}
+	p.statuses = kept
+}
+
+// Speed is the movement speed with status effects applied
+func (p *Player) Speed() float64 {
+	speed := p.speed
+	if p.HasStatus(StatusSpeed) {
+		speed *= speedBoostMultiplier
+	}
+	if p.HasStatus(StatusSlow) {
+		speed *= slowMultiplier
+	}
+	return speed
+}
+
+// applyMagnet pulls nearby fish towards the cat while the magnet is active
+func (g *Game) applyMagnet() {
+	if !g.player.HasStatus(StatusMagnet) {
+		return
+	}
+
+	px := g.player.x + float64(g.player.width)/2
+	py := g.player.y + float64(g.player.height)/2
+	for _, item := range g.items {
+		if item.collected || item.itemType != ItemGood {
+			continue
+		}
+		dx := px - (item.x + float64(item.width)/2)
+		dy := py - (item.y + float64(item.height)/2)
+		dist := math.Hypot(dx, dy)
+		if dist > 0 && dist < magnetRadius {
+			step := math.Min(magnetPull, dist)
+			item.x += dx / dist * step
+			item.y += dy / dist * step
+		}
+	}
+}
+
+// drawStatusIcons shows each active status with its remaining time in the
+// bottom-left corner
+func (g *Game) drawStatusIcons(screen *ebiten.Image) {
+	x := 10
+	y := screenHeight - 44
+	for _, s := range g.player.statuses {
+		def := statusDefs[s.kind]
+
+		icon := ebiten.NewImage(48, 34)
+		icon.Fill(color.RGBA{0, 0, 0, 180})
+		bar := ebiten.NewImage(48, 4)
+		bar.Fill(def.Color)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(0, 30)
+		icon.DrawImage(bar, op)
+
+		op = &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(x), float64(y))
+		screen.DrawImage(icon, op)
+
+		text.Draw(screen, def.Label, basicfont.Face7x13, x+14, y+13, def.Color)
+		secs := fmt.Sprintf("%ds", (s.ticksLeft+ebiten.DefaultTPS-1)/ebiten.DefaultTPS)
+		text.Draw(screen, secs, basicfont.Face7x13, x+24-len(secs)*7/2, y+26, color.White)
+
+		x += 54
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"log"
+	"sort"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/lafriks/go-tiled"
@@ -11,11 +13,19 @@ import (
 
 type TileMap struct {
 	tiledMap   *tiled.Map
-	tileImages map[uint32]*ebiten.Image
+	tileImages map[uint32]*ebiten.Image // by GID
 	width      int
 	height     int
 }
 
+// MapObject is an entity placed on a map's object layer, e.g. an NPC with
+// its patrol range. Tiled calls Kind the object's type or class.
+type MapObject struct {
+	Kind  string // player, portal, npc, car or item
+	X, Y  float64
+	Props map[string]string
+}
+
 func NewTileMap(tmxData []byte, tilesetImages map[string]*ebiten.Image) (*TileMap, error) {
 	tiledMap, err := tiled.LoadReader("map.tmx", bytes.NewReader(tmxData))
 	if err != nil {
@@ -90,7 +100,7 @@ func (tm *TileMap) Draw(screen *ebiten.Image, cameraX, cameraY float64) {
 					continue
 				}
 
-				tileImage := tm.tileImages[tile.ID]
+				tileImage := tm.tileImages[tileGID(tile)]
 				if tileImage == nil {
 					continue
 				}
@@ -119,3 +129,155 @@ func (tm *TileMap) Width() int {
 func (tm *TileMap) Height() int {
 	return tm.height
 }
+
+// TileSize is the size of one map tile in pixels
+func (tm *TileMap) TileSize() (int, int) {
+	return tm.tiledMap.TileWidth, tm.tiledMap.TileHeight
+}
+
+// TilesAt lists the tile under a world position on every layer, as
+// "layer: tileset#id", for debugging
+func (tm *TileMap) TilesAt(x, y float64) []string {
+	tileX := int(x) / tm.tiledMap.TileWidth
+	tileY := int(y) / tm.tiledMap.TileHeight
+	if x < 0 || y < 0 || tileX >= tm.tiledMap.Width || tileY >= tm.tiledMap.Height {
+		return nil
+	}
+
+	var tiles []string
+	for _, layer := range tm.tiledMap.Layers {
+		tileIndex := tileY*tm.tiledMap.Width + tileX
+		if tileIndex >= len(layer.Tiles) || layer.Tiles[tileIndex].IsNil() {
+			continue
+		}
+		tile := layer.Tiles[tileIndex]
+		tileset := ""
+		if tile.Tileset != nil {
+			tileset = tile.Tileset.Name
+		}
+		tiles = append(tiles, fmt.Sprintf("%s: %s#%d", layer.Name, tileset, tile.ID))
+	}
+	return tiles
+}
+
+// tileGID turns a decoded layer tile back into the GID used in the map data
+func tileGID(tile *tiled.LayerTile) uint32 {
+	if tile.IsNil() || tile.Tileset == nil {
+		return 0
+	}
+	return tile.Tileset.FirstGID + tile.ID
+}
+
+// TileGID is the GID of a tile on a layer, 0 for empty or out of range
+func (tm *TileMap) TileGID(layer, tileX, tileY int) uint32 {
+	if layer >= len(tm.tiledMap.Layers) || tileX < 0 || tileY < 0 || tileX >= tm.tiledMap.Width || tileY >= tm.tiledMap.Height {
+		return 0
+	}
+	tiles := tm.tiledMap.Layers[layer].Tiles
+	i := tileY*tm.tiledMap.Width + tileX
+	if i >= len(tiles) {
+		return 0
+	}
+	return tileGID(tiles[i])
+}
+
+// Property reads a map property, "" if the map doesn't have it
+func (tm *TileMap) Property(name string) string {
+	if tm.tiledMap.Properties == nil {
+		return ""
+	}
+	return tm.tiledMap.Properties.GetString(name)
+}
+
+// TileProperty reads a tileset property of the tile at a tile position,
+// checking layers from the top down. "" if no tile there has it.
+func (tm *TileMap) TileProperty(tileX, tileY int, name string) string {
+	for layer := len(tm.tiledMap.Layers) - 1; layer >= 0; layer-- {
+		gid := tm.TileGID(layer, tileX, tileY)
+		if gid == 0 {
+			continue
+		}
+		tile, err := tm.tiledMap.TileGIDToTile(gid)
+		if err != nil || tile.Tileset == nil {
+			continue
+		}
+		tilesetTile, err := tile.Tileset.GetTilesetTile(tile.ID)
+		if err != nil {
+			continue
+		}
+		if value := tilesetTile.Properties.GetString(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Solid is whether the tile at a tile position is a wall: one with the
+// "solid" property set to true. The cat can't walk into it.
+func (tm *TileMap) Solid(tileX, tileY int) bool {
+	return tm.TileProperty(tileX, tileY, "solid") == "true"
+}
+
+// SolidIn is whether any tile under a rectangle in pixels is solid
+func (tm *TileMap) SolidIn(x, y, w, h float64) bool {
+	tw, th := tm.TileSize()
+	for ty := int(y) / th; ty <= int(y+h-1)/th; ty++ {
+		for tx := int(x) / tw; tx <= int(x+w-1)/tw; tx++ {
+			if tm.Solid(tx, ty) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetTile changes one tile on a layer, 0 clears it
+func (tm *TileMap) SetTile(layer, tileX, tileY int, gid uint32) error {
+	if layer >= len(tm.tiledMap.Layers) || tileX < 0 || tileY < 0 || tileX >= tm.tiledMap.Width || tileY >= tm.tiledMap.Height {
+		return fmt.Errorf("tile %d,%d on layer %d is outside the map", tileX, tileY, layer)
+	}
+	tiles := tm.tiledMap.Layers[layer].Tiles
+	i := tileY*tm.tiledMap.Width + tileX
+	if i >= len(tiles) {
+		return fmt.Errorf("layer %d has no tile data at %d,%d", layer, tileX, tileY)
+	}
+	tile, err := tm.tiledMap.TileGIDToTile(gid)
+	if err != nil {
+		return err
+	}
+	tiles[i] = tile
+	return nil
+}
+
+// Palette lists every GID that has an image, in order
+func (tm *TileMap) Palette() []uint32 {
+	var gids []uint32
+	for gid := range tm.tileImages {
+		gids = append(gids, gid)
+	}
+	sort.Slice(gids, func(i, j int) bool { return gids[i] < gids[j] })
+	return gids
+}
+
+func (tm *TileMap) TileImage(gid uint32) *ebiten.Image {
+	return tm.tileImages[gid]
+}
+
+// Objects returns the entities on the map's object layers
+func (tm *TileMap) Objects() []MapObject {
+	var objects []MapObject
+	for _, group := range tm.tiledMap.ObjectGroups {
+		for _, o := range group.Objects {
+			kind := o.Type
+			if kind == "" {
+				kind = o.Class
+			}
+			obj := MapObject{Kind: kind, X: o.X, Y: o.Y, Props: make(map[string]string)}
+			for _, p := range o.Properties {
+				obj.Props[p.Name] = p.Value
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Flip flags stored in the top bits of a GID
+const (
+	gidFlipH = 0x80000000
+	gidFlipV = 0x40000000
+	gidFlipD = 0x20000000
+)
+
+// tmxMap is the subset of the TMX format the game writes, used by the level
+// editor and the level generator. Output opens in Tiled and loads with
+// NewTileMap.
+type tmxMap struct {
+	XMLName      xml.Name         `xml:"map"`
+	Version      string           `xml:"version,attr"`
+	Orientation  string           `xml:"orientation,attr"`
+	RenderOrder  string           `xml:"renderorder,attr"`
+	Width        int              `xml:"width,attr"`
+	Height       int              `xml:"height,attr"`
+	TileWidth    int              `xml:"tilewidth,attr"`
+	TileHeight   int              `xml:"tileheight,attr"`
+	Infinite     int              `xml:"infinite,attr"`
+	NextLayerID  int              `xml:"nextlayerid,attr"`
+	NextObjectID int              `xml:"nextobjectid,attr"`
+	Properties   *tmxProperties   `xml:"properties,omitempty"`
+	Tilesets     []tmxTileset     `xml:"tileset"`
+	Layers       []tmxLayer       `xml:"layer"`
+	ObjectGroups []tmxObjectGroup `xml:"objectgroup"`
+
+	lastLayerID, lastObjectID int
+}
+
+type tmxTileset struct {
+	FirstGID   uint32    `xml:"firstgid,attr"`
+	Name       string    `xml:"name,attr"`
+	TileWidth  int       `xml:"tilewidth,attr"`
+	TileHeight int       `xml:"tileheight,attr"`
+	TileCount  int       `xml:"tilecount,attr"`
+	Columns    int       `xml:"columns,attr"`
+	Image      *tmxImage `xml:"image,omitempty"`
+	Tiles      []tmxTile `xml:"tile"`
+}
+
+type tmxImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type tmxTile struct {
+	ID         uint32         `xml:"id,attr"`
+	Properties *tmxProperties `xml:"properties,omitempty"`
+	Image      *tmxImage      `xml:"image,omitempty"`
+}
+
+type tmxProperties struct {
+	Property []tmxProperty `xml:"property"`
+}
+
+type tmxProperty struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:"value,attr"`
+}
+
+type tmxLayer struct {
+	ID      int     `xml:"id,attr"`
+	Name    string  `xml:"name,attr"`
+	Width   int     `xml:"width,attr"`
+	Height  int     `xml:"height,attr"`
+	Visible int     `xml:"visible,attr"` // 0 or 1
+	Opacity float32 `xml:"opacity,attr"`
+	Data    tmxData `xml:"data"`
+}
+
+type tmxData struct {
+	Encoding string `xml:"encoding,attr"`
+	CSV      string `xml:",innerxml"` // only digits, commas and newlines
+}
+
+type tmxObjectGroup struct {
+	ID      int         `xml:"id,attr"`
+	Name    string      `xml:"name,attr"`
+	Objects []tmxObject `xml:"object"`
+}
+
+type tmxObject struct {
+	ID         int            `xml:"id,attr"`
+	Type       string         `xml:"type,attr,omitempty"`
+	X          float64        `xml:"x,attr"`
+	Y          float64        `xml:"y,attr"`
+	Properties *tmxProperties `xml:"properties,omitempty"`
+}
+
+func (p *tmxProperties) add(name, typ, value string) *tmxProperties {
+	if p == nil {
+		p = &tmxProperties{}
+	}
+	p.Property = append(p.Property, tmxProperty{Name: name, Type: typ, Value: value})
+	return p
+}
+
+// propertyType guesses the Tiled type of an object property so it shows up
+// right in Tiled; everything is read back as a string anyway
+func propertyType(value string) string {
+	if value == "true" || value == "false" {
+		return "bool"
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "float"
+	}
+	return ""
+}
+
+func newTMXMap(width, height, tileWidth, tileHeight int) *tmxMap {
+	return &tmxMap{
+		Version:     "1.10",
+		Orientation: "orthogonal",
+		RenderOrder: "right-down",
+		Width:       width,
+		Height:      height,
+		TileWidth:   tileWidth,
+		TileHeight:  tileHeight,
+	}
+}
+
+// AddLayer adds a visible, opaque tile layer from GIDs in row order and
+// returns it
+func (m *tmxMap) AddLayer(name string, gids []uint32) *tmxLayer {
+	rows := make([]string, m.Height)
+	for y := range rows {
+		cols := make([]string, m.Width)
+		for x := range cols {
+			cols[x] = strconv.FormatUint(uint64(gids[y*m.Width+x]), 10)
+		}
+		rows[y] = strings.Join(cols, ",")
+	}
+	m.lastLayerID++
+	m.Layers = append(m.Layers, tmxLayer{
+		ID:      m.lastLayerID,
+		Name:    name,
+		Width:   m.Width,
+		Height:  m.Height,
+		Visible: 1,
+		Opacity: 1,
+		Data:    tmxData{Encoding: "csv", CSV: "\n" + strings.Join(rows, ",\n") + "\n"},
+	})
+	return &m.Layers[len(m.Layers)-1]
+}
+
+// AddObjects adds an object layer holding the level's entities
+func (m *tmxMap) AddObjects(name string, objects []MapObject) {
+	m.lastLayerID++
+	group := tmxObjectGroup{ID: m.lastLayerID, Name: name}
+	for _, obj := range objects {
+		m.lastObjectID++
+		o := tmxObject{ID: m.lastObjectID, Type: obj.Kind, X: obj.X, Y: obj.Y}
+		var names []string
+		for name := range obj.Props {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			o.Properties = o.Properties.add(name, propertyType(obj.Props[name]), obj.Props[name])
+		}
+		group.Objects = append(group.Objects, o)
+	}
+	m.ObjectGroups = append(m.ObjectGroups, group)
+}
+
+func (m *tmxMap) Encode() ([]byte, error) {
+	m.NextLayerID = m.lastLayerID + 1
+	m.NextObjectID = m.lastObjectID + 1
+
+	out, err := xml.MarshalIndent(m, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+// TMX converts the map back to TMX with the given entities. imageSource
+// rewrites tileset image paths, e.g. when saving somewhere else.
+func (tm *TileMap) TMX(objects []MapObject, imageSource func(string) string) (*tmxMap, error) {
+	src := tm.tiledMap
+	m := newTMXMap(src.Width, src.Height, src.TileWidth, src.TileHeight)
+	if src.Properties != nil {
+		for _, p := range *src.Properties {
+			m.Properties = m.Properties.add(p.Name, p.Type, p.Value)
+		}
+	}
+
+	convertImage := func(img *tmxImage) *tmxImage {
+		img.Source = imageSource(img.Source)
+		return img
+	}
+
+	for _, ts := range src.Tilesets {
+		if ts.Source != "" {
+			return nil, fmt.Errorf("external tileset %s can't be saved", ts.Source)
+		}
+		out := tmxTileset{
+			FirstGID:   ts.FirstGID,
+			Name:       ts.Name,
+			TileWidth:  ts.TileWidth,
+			TileHeight: ts.TileHeight,
+			TileCount:  ts.TileCount,
+			Columns:    ts.Columns,
+		}
+		if ts.Image != nil {
+			out.Image = convertImage(&tmxImage{Source: ts.Image.Source, Width: ts.Image.Width, Height: ts.Image.Height})
+		}
+		for _, tile := range ts.Tiles {
+			t := tmxTile{ID: tile.ID}
+			for _, p := range tile.Properties {
+				t.Properties = t.Properties.add(p.Name, p.Type, p.Value)
+			}
+			if tile.Image != nil {
+				t.Image = convertImage(&tmxImage{Source: tile.Image.Source, Width: tile.Image.Width, Height: tile.Image.Height})
+			}
+			out.Tiles = append(out.Tiles, t)
+		}
+		m.Tilesets = append(m.Tilesets, out)
+	}
+
+	for _, layer := range src.Layers {
+		gids := make([]uint32, src.Width*src.Height)
+		for i, tile := range layer.Tiles {
+			if i >= len(gids) {
+				break
+			}
+			gid := tileGID(tile)
+			if gid != 0 {
+				if tile.HorizontalFlip {
+					gid |= gidFlipH
+				}
+				if tile.VerticalFlip {
+					gid |= gidFlipV
+				}
+				if tile.DiagonalFlip {
+					gid |= gidFlipD
+				}
+			}
+			gids[i] = gid
+		}
+		out := m.AddLayer(layer.Name, gids)
+		if !layer.Visible {
+			out.Visible = 0
+		}
+		out.Opacity = layer.Opacity
+	}
+
+	if len(objects) > 0 {
+		m.AddObjects("entities", objects)
+	}
+	return m, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/lafriks/go-tiled"
+)
+
+// validator checks the asset tree without starting the game. Everything
+// reachable from the game's own asset paths is marked used; other files are
+// still checked but reported as unused.
+type validator struct {
+	fsys     fs.FS
+	used     map[string]bool
+	marking  bool // mark checked files as used
+	sizes    map[string]image.Point
+	problems map[string]bool
+}
+
+// runValidate checks every asset and prints a report. It returns the exit
+// code: 1 if anything is missing or broken.
+func runValidate(fsys fs.FS) int {
+	v := &validator{
+		fsys:     fsys,
+		used:     make(map[string]bool),
+		marking:  true,
+		sizes:    make(map[string]image.Point),
+		problems: make(map[string]bool),
+	}
+
+	// What the game loads
+	for _, name := range levelMaps[1:] {
+		v.checkTMX(name)
+	}
+	for i := 1; i <= 8; i++ {
+		v.checkAtlas(fmt.Sprintf(walkAtlasPath, i))
+		v.checkAtlas(fmt.Sprintf(attackAtlasPath, i))
+	}
+	for _, name := range []string{portalAtlasPath, walkerAtlasPath, limoAtlasPath, policeAtlasPath} {
+		v.checkAtlas(name)
+	}
+	v.checkImage(portraitPath)
+	v.checkData()
+
+	// Everything else is checked too, but not counted as used
+	v.marking = false
+	var all []string
+	fs.WalkDir(fsys, "assets", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			v.fail("%s: %v", name, err)
+			return nil
+		}
+		if !d.IsDir() {
+			all = append(all, name)
+		}
+		return nil
+	})
+	for _, name := range all {
+		if v.used[name] {
+			continue
+		}
+		switch path.Ext(name) {
+		case ".tmx":
+			v.checkTMX(name)
+		case ".json":
+			v.checkAtlas(name)
+		case ".png":
+			v.checkImage(name)
+		case ".mp3", ".ogg", ".wav":
+			v.checkSound(name)
+		}
+	}
+
+	var unused []string
+	for _, name := range all {
+		if !v.used[name] {
+			unused = append(unused, name)
+		}
+	}
+
+	fmt.Printf("Checked %d asset files\n", len(all))
+	if len(unused) > 0 {
+		fmt.Printf("\n%d unused asset(s):\n", len(unused))
+		for _, name := range unused {
+			fmt.Println("  " + name)
+		}
+	}
+	if len(v.problems) > 0 {
+		var problems []string
+		for p := range v.problems {
+			problems = append(problems, p)
+		}
+		sort.Strings(problems)
+		fmt.Printf("\n%d problem(s):\n", len(problems))
+		for _, p := range problems {
+			fmt.Println("  " + p)
+		}
+		return 1
+	}
+	fmt.Println("\nAll assets OK")
+	return 0
+}
+
+func (v *validator) fail(format string, args ...any) {
+	v.problems[fmt.Sprintf(format, args...)] = true
+}
+
+func (v *validator) read(name string) ([]byte, bool) {
+	data, err := fs.ReadFile(v.fsys, name)
+	if err != nil {
+		v.fail("%s: missing (%v)", name, err)
+		return nil, false
+	}
+	if v.marking {
+		v.used[name] = true
+	}
+	return data, true
+}
+
+// checkImage decodes an image and returns its size
+func (v *validator) checkImage(name string) (image.Point, bool) {
+	if size, ok := v.sizes[name]; ok {
+		if v.marking {
+			v.used[name] = true
+		}
+		return size, true
+	}
+
+	data, ok := v.read(name)
+	if !ok {
+		return image.Point{}, false
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		v.fail("%s: can't decode image: %v", name, err)
+		return image.Point{}, false
+	}
+	size := img.Bounds().Size()
+	v.sizes[name] = size
+	return size, true
+}
+
+func (v *validator) checkSound(name string) {
+	data, ok := v.read(name)
+	if !ok {
+		return
+	}
+	if _, err := decodeSound(name, data); err != nil {
+		v.fail("%s: can't decode sound: %v", name, err)
+	}
+}
+
+// checkTMX parses a map and checks its tileset images match the sizes
+// written in the map
+func (v *validator) checkTMX(name string) {
+	data, ok := v.read(name)
+	if !ok {
+		return
+	}
+	m, err := tiled.LoadReader(name, bytes.NewReader(data))
+	if err != nil {
+		v.fail("%s: can't parse map: %v", name, err)
+		return
+	}
+
+	for _, ts := range m.Tilesets {
+		if ts.Image != nil {
+			v.checkTilesetImage(name, ts.Image)
+		}
+		for _, tile := range ts.Tiles {
+			if tile.Image != nil {
+				v.checkTilesetImage(name, tile.Image)
+			}
+		}
+	}
+}
+
+func (v *validator) checkTilesetImage(tmx string, img *tiled.Image) {
+	name := path.Join(path.Dir(tmx), img.Source)
+	size, ok := v.checkImage(name)
+	if !ok {
+		return
+	}
+	if (img.Width != 0 && img.Width != size.X) || (img.Height != 0 && img.Height != size.Y) {
+		v.fail("%s: %s is %dx%d, map says %dx%d", tmx, img.Source, size.X, size.Y, img.Width, img.Height)
+	}
+}
+
+// checkAtlas checks a sprite sheet JSON file and that every frame fits in
+// its image. Data files under assets/data aren't atlases and are skipped.
+func (v *validator) checkAtlas(name string) {
+	if strings.HasPrefix(name, "assets/data/") {
+		return
+	}
+	data, ok := v.read(name)
+	if !ok {
+		return
+	}
+	meta, frames, err := parseAtlasJSON(data)
+	if err != nil {
+		v.fail("%s: can't parse atlas: %v", name, err)
+		return
+	}
+	if meta.Meta.Image == "" {
+		v.fail("%s: no meta.image", name)
+		return
+	}
+
+	sheet := path.Join(path.Dir(name), meta.Meta.Image)
+	size, ok := v.checkImage(sheet)
+	if !ok {
+		return
+	}
+	bounds := image.Rectangle{Max: size}
+	for i, f := range frames {
+		r := image.Rect(f.Frame.X, f.Frame.Y, f.Frame.X+f.Frame.W, f.Frame.Y+f.Frame.H)
+		if r.Empty() || !r.In(bounds) {
+			v.fail("%s: frame %d %v is outside the %dx%d sheet", name, i, r, size.X, size.Y)
+		}
+	}
+	for _, t := range meta.Meta.FrameTags {
+		if t.From < 0 || t.To >= len(frames) || t.From > t.To {
+			v.fail("%s: tag %q frames %d-%d out of range", name, t.Name, t.From, t.To)
+		}
+	}
+}
+
+// checkData parses the JSON data files and checks the item images exist
+func (v *validator) checkData() {
+	items, err := LoadItemRegistry(v.fsys, itemsFile, func(name string) *ebiten.Image {
+		v.checkImage(name)
+		return nil
+	})
+	if err != nil {
+		v.fail("%v", err)
+	} else {
+		v.used[itemsFile] = true
+	}
+
+	sounds, err := LoadSoundRegistry(v.fsys, soundsFile)
+	if err != nil {
+		v.fail("%v", err)
+	} else {
+		v.used[soundsFile] = true
+		for _, name := range append(sounds.Files(), sounds.MusicFiles()...) {
+			v.checkSound(name)
+		}
+	}
+
+	achievements, err := LoadAchievementDefs(v.fsys, achievementsFile)
+	if err != nil {
+		v.fail("%v", err)
+	} else {
+		v.used[achievementsFile] = true
+		for _, d := range achievements {
+			if d.Species != "" && items != nil && items.Get(d.Species) == nil {
+				v.fail("%s: achievement %q counts unknown species %q", achievementsFile, d.ID, d.Species)
+			}
+		}
+	}
+
+	if data, ok := v.read(questsFile); ok {
+		var defs []*QuestDef
+		if err := json.Unmarshal(data, &defs); err != nil {
+			v.fail("%s: %v", questsFile, err)
+		} else if !slices.ContainsFunc(defs, func(d *QuestDef) bool { return d.Objective && d.Level == 0 }) {
+			v.fail("%s: no objective quest for every level, the portal would start open", questsFile)
+		}
+	}
+
+	entries, err := fs.ReadDir(v.fsys, dialogueDir)
+	if err != nil {
+		v.fail("%s: %v", dialogueDir, err)
+		return
+	}
+	for _, entry := range entries {
+		name := path.Join(dialogueDir, entry.Name())
+		if entry.IsDir() || path.Ext(name) != ".json" {
+			continue
+		}
+		if data, ok := v.read(name); ok {
+			var d Dialogue
+			if err := json.Unmarshal(data, &d); err != nil {
+				v.fail("%s: %v", name, err)
+			} else if !d.hasFallbackStart() {
+				v.fail("%s: needs a start node without an \"if\", so talking always opens the dialogue", name)
+			}
+		}
+	}
+}